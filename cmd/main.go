@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -27,6 +28,9 @@ func main() {
 
 	port := flag.Int("port", 8090, "Port number")
 	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", dbUser, dbPassword, dbHost, dbPort, dbName)
+	requestTimeout := flag.Duration("request-timeout", 5*time.Second, "Deadline for regular requests")
+	reportTimeout := flag.Duration("report-timeout", 30*time.Second, "Deadline for report requests")
+	idempotencyWindow := flag.Duration("idempotency-window", 24*time.Hour, "How long Idempotency-Key responses are kept")
 	help := flag.Bool("help", false, "Show help")
 	flag.Parse()
 
@@ -38,14 +42,14 @@ func main() {
 	// Connect to the PostgreSQL database
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
-		log.Printf("Failed to open database connection", "error", err)
+		log.Print("Failed to open database connection", "error", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
 	// Verify the connection is alive
 	if err := db.Ping(); err != nil {
-		log.Printf("Failed to ping database", "error", err)
+		log.Print("Failed to ping database", "error", err)
 		os.Exit(1)
 	}
 
@@ -54,19 +58,26 @@ func main() {
 	menuRepo := repository.NewMenuRepository(db)
 	inventoryRepo := repository.NewInventoryRepository(db)
 	reportRepo := repository.NewReportRepository(db)
+	modifierRepo := repository.NewModifierRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
 
 	// Initialize services
-	orderSvc := service.NewOrderService(orderRepo, menuRepo, inventoryRepo, db)
-	menuSvc := service.NewMenuService(menuRepo)
-	inventorySvc := service.NewInventoryService(inventoryRepo)
+	orderSvc := service.NewOrderService(orderRepo, menuRepo, inventoryRepo, modifierRepo, idempotencyRepo, db)
+	menuSvc := service.NewMenuService(menuRepo, modifierRepo, inventoryRepo)
+	inventorySvc := service.NewInventoryService(inventoryRepo, db)
 	reportsSvc := service.NewReportsService(orderRepo, menuRepo, reportRepo)
+	modifierSvc := service.NewModifierService(modifierRepo, menuRepo, inventoryRepo)
+	idempotencySvc := service.NewIdempotencyService(idempotencyRepo, *idempotencyWindow)
 
 	// Initialize router
-	router := api.NewRouter(orderSvc, menuSvc, inventorySvc, reportsSvc)
+	router := api.NewRouter(orderSvc, menuSvc, inventorySvc, reportsSvc, modifierSvc, idempotencySvc, api.Timeouts{
+		Default: *requestTimeout,
+		Reports: *reportTimeout,
+	})
 
-	log.Printf("Starting server", "port", *port)
+	log.Print("Starting server", "port", *port)
 	if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), router); err != nil {
-		log.Printf("Failed to start server", "error", err)
+		log.Print("Failed to start server", "error", err)
 		os.Exit(1)
 	}
 }
@@ -75,11 +86,16 @@ func printUsage() {
 	fmt.Println(`Coffee Shop Management System
 
 Usage:
-  frappuccino [--port <N>] [--db <connection-string>]
+  frappuccino [--port <N>] [--db <connection-string>] [--request-timeout <D>] [--report-timeout <D>]
+              [--idempotency-window <D>]
   frappuccino --help
 
 Options:
-  --help       Show this screen.
-  --port N     Port number.
-  --db S       PostgreSQL connection string.`)
+  --help               Show this screen.
+  --port N             Port number.
+  --db S               PostgreSQL connection string.
+  --request-timeout D  Deadline for regular requests, e.g. 5s (0 disables it).
+  --report-timeout D   Deadline for report requests, e.g. 30s (0 disables it).
+  --idempotency-window D
+                       How long Idempotency-Key responses are kept, e.g. 24h.`)
 }
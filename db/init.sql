@@ -1,7 +1,13 @@
 -- ENUM Types
 CREATE TYPE order_status AS ENUM ('pending', 'processing', 'closed', 'cancelled');
 CREATE TYPE inventory_unit AS ENUM ('kg', 'g', 'liter', 'ml', 'unit');
-CREATE TYPE transaction_type AS ENUM ('initial_stock', 'purchase', 'waste', 'adjustment');
+CREATE TYPE modifier_kind AS ENUM ('add', 'substitute');
+CREATE TYPE transaction_type AS ENUM ('initial_stock', 'purchase', 'waste', 'adjustment', 'order_consumption', 'order_return');
+
+-- unit_factor is how many base units (g, ml or unit) one of u holds.
+CREATE OR REPLACE FUNCTION unit_factor(u inventory_unit) RETURNS numeric
+    LANGUAGE SQL IMMUTABLE
+    AS $$ SELECT CASE u WHEN 'kg' THEN 1000 WHEN 'liter' THEN 1000 ELSE 1 END::numeric $$;
 
 DROP TABLE IF EXISTS orders;
 DROP TABLE IF EXISTS menu_items;
@@ -11,6 +17,9 @@ DROP TABLE IF EXISTS menu_item_ingredients;
 DROP TABLE IF EXISTS order_status_history;
 DROP TABLE IF EXISTS price_history;
 DROP TABLE IF EXISTS inventory_transactions;
+DROP TABLE IF EXISTS modifiers;
+DROP TABLE IF EXISTS modifier_ingredients;
+DROP TABLE IF EXISTS modifier_products;
 
 --
 -- Orders Table
@@ -19,6 +28,7 @@ CREATE TABLE orders (
     customer_name VARCHAR(255) NOT NULL,
     total_price DECIMAL(10, 2) NOT NULL DEFAULT 0,
     status order_status NOT NULL DEFAULT 'pending',
+    version INT NOT NULL DEFAULT 1,
     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
@@ -31,6 +41,8 @@ CREATE TABLE menu_items (
     description TEXT,
     categories TEXT[] NOT NULL,
     price DECIMAL(10, 2) NOT NULL CHECK(price >= 0),
+    version INT NOT NULL DEFAULT 1,
+    archived_at TIMESTAMPTZ,
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -40,8 +52,11 @@ CREATE TABLE menu_items (
 CREATE TABLE inventory ( 
     ingredient_id SERIAL PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
-    quantity INTEGER NOT NULL DEFAULT 0 CHECK(quantity >= 0),
+    quantity DECIMAL(12, 3) NOT NULL DEFAULT 0 CHECK(quantity >= 0),
     unit inventory_unit,
+    reorder_level DECIMAL(12, 3) NOT NULL DEFAULT 0 CHECK(reorder_level >= 0),
+    cost_per_unit DECIMAL(12, 4) NOT NULL DEFAULT 0 CHECK(cost_per_unit >= 0),
+    version INT NOT NULL DEFAULT 1,
     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
@@ -51,9 +66,12 @@ CREATE TABLE inventory (
 CREATE TABLE order_items (
     id SERIAL PRIMARY KEY,
     order_id INT NOT NULL REFERENCES orders(order_id) ON DELETE CASCADE,
-    product_id INT NOT NULL REFERENCES menu_items(product_id) ON DELETE CASCADE,
+    product_id INT NOT NULL REFERENCES menu_items(product_id) ON DELETE RESTRICT,
     quantity INT NOT NULL CHECK(quantity >= 0),
-    customization JSONB DEFAULT '{}'::JSONB
+    unit_price DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK(unit_price >= 0),
+    customization JSONB DEFAULT '{}'::JSONB,
+    -- what one unit of the line took from stock, in base units, when it was added
+    consumption JSONB NOT NULL DEFAULT '[]'::JSONB
 );
 
 --
@@ -61,7 +79,9 @@ CREATE TABLE order_items (
 CREATE TABLE menu_item_ingredients (
     ingredient_id INT NOT NULL REFERENCES inventory(ingredient_id) ON DELETE CASCADE,
     product_id INT NOT NULL REFERENCES menu_items(product_id) ON DELETE CASCADE,
-    quantity INT NOT NULL CHECK(quantity >= 0),
+    quantity DECIMAL(12, 3) NOT NULL CHECK(quantity >= 0),
+    -- unit the quantity is measured in; NULL means the ingredient's inventory unit
+    unit inventory_unit,
     PRIMARY KEY (product_id, ingredient_id)
 );
 
@@ -88,44 +108,94 @@ CREATE TABLE price_history (
 -- Inventory Transactions
 CREATE TABLE inventory_transactions (
     id SERIAL PRIMARY KEY,
-    inventory_id INT NOT NULL REFERENCES inventory(ingredient_id) ON DELETE CASCADE,
-    quantity_change INT NOT NULL,
+    inventory_id INT REFERENCES inventory(ingredient_id) ON DELETE SET NULL,
+    quantity_change DECIMAL(12, 3) NOT NULL,
+    -- unit is what the item was stocked in when the row was recorded; rows are never rewritten.
+    unit inventory_unit,
     transaction_type transaction_type NOT NULL,
+    reason TEXT,
+    order_id INT REFERENCES orders(order_id) ON DELETE SET NULL,
+    unit_cost DECIMAL(12, 4) CHECK(unit_cost >= 0),
     transaction_date TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
+--
+-- Modifiers (add-ons and substitutions customers can apply to a drink)
+CREATE TABLE modifiers (
+    modifier_id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    kind modifier_kind NOT NULL DEFAULT 'add',
+    price_delta DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    replaces_ingredient_id INT REFERENCES inventory(ingredient_id) ON DELETE CASCADE,
+    substitute_ingredient_id INT REFERENCES inventory(ingredient_id) ON DELETE CASCADE,
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (kind <> 'substitute' OR (replaces_ingredient_id IS NOT NULL AND substitute_ingredient_id IS NOT NULL))
+);
+
+--
+-- Modifier Ingredients (what an 'add' modifier puts on top of the recipe)
+CREATE TABLE modifier_ingredients (
+    modifier_id INT NOT NULL REFERENCES modifiers(modifier_id) ON DELETE CASCADE,
+    ingredient_id INT NOT NULL REFERENCES inventory(ingredient_id) ON DELETE CASCADE,
+    quantity DECIMAL(12, 3) NOT NULL CHECK(quantity >= 0),
+    PRIMARY KEY (modifier_id, ingredient_id)
+);
+
+--
+-- Modifier Products (menu items a modifier is restricted to, besides its categories)
+CREATE TABLE modifier_products (
+    modifier_id INT NOT NULL REFERENCES modifiers(modifier_id) ON DELETE CASCADE,
+    product_id INT NOT NULL REFERENCES menu_items(product_id) ON DELETE CASCADE,
+    PRIMARY KEY (modifier_id, product_id)
+);
+
+--
+-- Idempotency Keys (responses of POST /orders, replayed when a client retries with the same key)
+CREATE TABLE idempotency_keys (
+    idempotency_key VARCHAR(255) PRIMARY KEY,
+    request_hash CHAR(64) NOT NULL,
+    status_code INT,
+    response_body TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Indexes
+CREATE INDEX idx_orders_created_at ON orders(created_at, order_id);
+CREATE INDEX idx_orders_status ON orders(status);
 CREATE INDEX idx_order_items_order_id ON order_items(order_id);
 CREATE INDEX idx_order_items_product_id ON order_items(product_id);
 CREATE INDEX idx_order_status_history_order_id ON order_status_history(order_id);
 CREATE INDEX idx_menu_item_ingredients_product_id ON menu_item_ingredients(product_id);
 CREATE INDEX idx_menu_item_ingredients_ingredient_id ON menu_item_ingredients(ingredient_id);
 CREATE INDEX idx_price_history_product_id ON price_history(product_id);
-CREATE INDEX idx_inventory_transactions_inventory_id ON inventory_transactions(inventory_id);
+CREATE INDEX idx_inventory_transactions_inventory_id ON inventory_transactions(inventory_id, transaction_date);
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys(created_at);
 
 
 -- Insert inventory items
-INSERT INTO inventory (name, quantity, unit) VALUES
-('Espresso Beans', 5000, 'g'),
-('Milk', 10000, 'ml'),
-('Sugar', 3000, 'g'),
-('Vanilla Syrup', 2000, 'ml'),
-('Caramel Syrup', 1500, 'ml'),
-('Chocolate Syrup', 1500, 'ml'),
-('Whipped Cream', 500, 'ml'),
-('Ice Cubes', 2000, 'g'),
-('Paper Cups', 300, 'unit'),
-('Lids', 300, 'unit'),
-('Straws', 300, 'unit'),
-('Green Tea Leaves', 2000, 'g'),
-('Matcha Powder', 1000, 'g'),
-('Lemon', 100, 'unit'),
-('Honey', 800, 'ml'),
-('Cinnamon', 300, 'g'),
-('Oat Milk', 5000, 'ml'),
-('Coconut Milk', 4000, 'ml'),
-('Espresso Shot', 100, 'unit'),
-('Cold Brew Concentrate', 2000, 'ml');
+INSERT INTO inventory (name, quantity, unit, reorder_level, cost_per_unit) VALUES
+('Espresso Beans', 5000, 'g', 1000, 0.03),
+('Milk', 10000, 'ml', 2000, 0.0012),
+('Sugar', 3000, 'g', 500, 0.002),
+('Vanilla Syrup', 2000, 'ml', 300, 0.01),
+('Caramel Syrup', 1500, 'ml', 300, 0.01),
+('Chocolate Syrup', 1500, 'ml', 300, 0.012),
+('Whipped Cream', 500, 'ml', 100, 0.008),
+('Ice Cubes', 2000, 'g', 500, 0.0005),
+('Paper Cups', 300, 'unit', 50, 0.10),
+('Lids', 300, 'unit', 50, 0.05),
+('Straws', 300, 'unit', 50, 0.02),
+('Green Tea Leaves', 2000, 'g', 300, 0.06),
+('Matcha Powder', 1000, 'g', 200, 0.15),
+('Lemon', 100, 'unit', 20, 0.30),
+('Honey', 800, 'ml', 100, 0.015),
+('Cinnamon', 300, 'g', 50, 0.04),
+('Oat Milk', 5000, 'ml', 1000, 0.003),
+('Coconut Milk', 4000, 'ml', 800, 0.0035),
+('Espresso Shot', 100, 'unit', 20, 0.50),
+('Cold Brew Concentrate', 2000, 'ml', 400, 0.01);
 
 -- Insert menu items
 INSERT INTO menu_items (product_name, description, categories, price) VALUES
@@ -144,8 +214,8 @@ INSERT INTO menu_items (product_name, description, categories, price) VALUES
 INSERT INTO menu_item_ingredients (product_id, ingredient_id, quantity) VALUES
 -- Latte: espresso beans + milk
 (1, 1, 18), (1, 2, 240),
--- Cappuccino: espresso + milk + foam
-(2, 1, 18), (2, 2, 180),
+-- Cappuccino: espresso + milk + foam + a dusting of cinnamon
+(2, 1, 18), (2, 2, 180), (2, 16, 0.5),
 -- Americano
 (3, 1, 18),
 -- Iced Latte
@@ -153,7 +223,7 @@ INSERT INTO menu_item_ingredients (product_id, ingredient_id, quantity) VALUES
 -- Mocha
 (5, 1, 18), (5, 2, 240), (5, 6, 30),
 -- Caramel Macchiato
-(6, 1, 18), (6, 2, 240), (6, 4, 20), (6, 5, 20),
+(6, 1, 18), (6, 2, 240), (6, 4, 7.5), (6, 5, 20),
 -- Matcha Latte
 (7, 13, 10), (7, 2, 240),
 -- Green Tea
@@ -163,6 +233,26 @@ INSERT INTO menu_item_ingredients (product_id, ingredient_id, quantity) VALUES
 -- Cold Brew
 (10, 20, 240);
 
+-- Insert modifiers
+INSERT INTO modifiers (name, kind, price_delta, replaces_ingredient_id, substitute_ingredient_id, categories) VALUES
+('Oat Milk', 'substitute', 0.50, 2, 17, '{}'),
+('Coconut Milk', 'substitute', 0.50, 2, 18, '{}'),
+('Extra Shot', 'add', 0.80, NULL, NULL, ARRAY['coffee']),
+('Extra Vanilla', 'add', 0.40, NULL, NULL, '{}'),
+('Extra Caramel', 'add', 0.40, NULL, NULL, '{}'),
+('Whipped Cream', 'add', 0.30, NULL, NULL, '{}');
+
+INSERT INTO modifier_ingredients (modifier_id, ingredient_id, quantity) VALUES
+(3, 1, 18),
+(4, 4, 20),
+(5, 5, 20),
+(6, 7, 30);
+
+-- Whipped cream only goes on the mocha and the caramel macchiato
+INSERT INTO modifier_products (modifier_id, product_id) VALUES
+(6, 5),
+(6, 6);
+
 -- Insert 30 orders
 INSERT INTO orders (customer_name, total_price, status, created_at) VALUES
 ('Alice', 4.50, 'pending', '2024-12-01'),
@@ -229,6 +319,31 @@ INSERT INTO order_items (order_id, product_id, quantity) VALUES
 (29, 9, 1),
 (30, 1, 1);
 
+-- Snapshot the menu prices on the order lines and derive the order totals from them
+UPDATE order_items oi SET unit_price = mi.price
+FROM menu_items mi
+WHERE mi.product_id = oi.product_id;
+
+-- and record what one unit of each line consumed under the recipes they were made with
+UPDATE order_items oi SET consumption = COALESCE((
+    SELECT jsonb_agg(jsonb_build_object(
+        'ingredient_id', i.ingredient_id,
+        'quantity', mii.quantity * unit_factor(COALESCE(mii.unit, i.unit)),
+        'unit', CASE WHEN COALESCE(mii.unit, i.unit) IN ('kg', 'g') THEN 'g'
+                     WHEN COALESCE(mii.unit, i.unit) IN ('liter', 'ml') THEN 'ml'
+                     ELSE 'unit' END
+    ) ORDER BY i.ingredient_id)
+    FROM menu_item_ingredients mii
+    JOIN inventory i ON i.ingredient_id = mii.ingredient_id
+    WHERE mii.product_id = oi.product_id
+), '[]');
+
+UPDATE orders o SET total_price = (
+    SELECT COALESCE(SUM(oi.unit_price * oi.quantity), 0)
+    FROM order_items oi
+    WHERE oi.order_id = o.order_id
+);
+
 
 -- Order status history
 INSERT INTO order_status_history (order_id, status, changed_at) VALUES
@@ -393,4 +508,9 @@ INSERT INTO inventory_transactions (inventory_id, quantity_change, transaction_t
 (19, 50, 'initial_stock', '2024-10-01'),       -- Espresso Shot
 (20, 700, 'purchase', '2024-10-09');           -- Cold Brew Concentrate
 
+UPDATE inventory_transactions t SET unit = i.unit
+FROM inventory i
+WHERE i.ingredient_id = t.inventory_id;
+ALTER TABLE inventory_transactions ALTER COLUMN unit SET NOT NULL;
+
 
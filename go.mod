@@ -5,3 +5,5 @@ go 1.22
 require github.com/lib/pq v1.10.9
 
 require github.com/joho/godotenv v1.5.1
+
+require github.com/shopspring/decimal v1.4.0
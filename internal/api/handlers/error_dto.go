@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"frappuccino/internal/service"
+	"frappuccino/models"
+)
+
+type IngredientShortageResponse struct {
+	IngredientID int64       `json:"ingredient_id"`
+	Name         string      `json:"name"`
+	Unit         string      `json:"unit"`
+	Required     JSONDecimal `json:"required"`
+	Available    JSONDecimal `json:"available"`
+}
+
+type TransitionErrorResponse struct {
+	From models.OrderStatus `json:"from"`
+	To   models.OrderStatus `json:"to"`
+}
+
+type DependentResponse struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type IngredientDependentsResponse struct {
+	MenuItems []DependentResponse `json:"menu_items"`
+	Modifiers []DependentResponse `json:"modifiers"`
+}
+
+func errorDetails(details any) any {
+	switch d := details.(type) {
+	case []models.IngredientShortage:
+		resp := make([]IngredientShortageResponse, 0, len(d))
+		for _, sh := range d {
+			resp = append(resp, IngredientShortageResponse{
+				IngredientID: sh.IngredientID,
+				Name:         sh.Name,
+				Unit:         sh.Unit,
+				Required:     JSONDecimal{sh.Required},
+				Available:    JSONDecimal{sh.Available},
+			})
+		}
+		return resp
+	case *service.TransitionError:
+		return TransitionErrorResponse{From: d.From, To: d.To}
+	case models.IngredientDependents:
+		return IngredientDependentsResponse{
+			MenuItems: newDependentResponses(d.MenuItems),
+			Modifiers: newDependentResponses(d.Modifiers),
+		}
+	}
+	return details
+}
+
+func newDependentResponses(dependents []models.IngredientDependent) []DependentResponse {
+	resp := make([]DependentResponse, 0, len(dependents))
+	for _, d := range dependents {
+		resp = append(resp, DependentResponse{ID: d.ID, Name: d.Name})
+	}
+	return resp
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"frappuccino/internal/apperr"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// requireIfMatch guards PUT, PATCH and DELETE, where "*" is the explicit opt-out.
+func requireIfMatch(r *http.Request) (int64, error) {
+	if strings.TrimSpace(r.Header.Get("If-Match")) == "" {
+		return 0, apperr.PreconditionRequired("If-Match is required; send the ETag of the version being changed, or * to overwrite any version")
+	}
+	return ifMatch(r)
+}
+
+func ifMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	if strings.Contains(value, ",") {
+		return 0, apperr.Validation("If-Match must name a single ETag")
+	}
+	tag, ok := strings.CutPrefix(value, `"`)
+	if ok {
+		tag, ok = strings.CutSuffix(tag, `"`)
+	}
+	if !ok {
+		// Weak tags never match in If-Match, and ours are all strong.
+		if strings.HasPrefix(value, `W/"`) {
+			return 0, apperr.PreconditionFailed("If-Match %s does not match the current version", value)
+		}
+		return 0, apperr.Validation("invalid If-Match header %q", value)
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, apperr.PreconditionFailed("If-Match %s does not match the current version", value)
+	}
+	return version, nil
+}
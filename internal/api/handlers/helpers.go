@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/apperr"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+)
+
+// JSONDecimal is a decimal that response DTOs encode as a plain JSON number,
+// e.g. 7.5 rather than "7.5", without changing how decimals are encoded elsewhere.
+type JSONDecimal struct{ decimal.Decimal }
+
+func (d JSONDecimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+type ErrorResponse struct {
+	Code    apperr.Code `json:"code"`
+	Message string      `json:"message"`
+	Details any         `json:"details,omitempty"`
+}
+
+func pathID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(r.PathValue("id"), 10, 64)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print("Failed to encode response", "error", err)
+	}
+}
+
+func writeRawJSON(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Print("Failed to write response", "error", err)
+	}
+}
+
+// writeError hides errors without an apperr code, so database details never
+// reach the client. Once r's deadline has passed they are reported as a
+// timeout, since the driver reports cancelled queries with errors of its own.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *apperr.Error
+	switch {
+	case errors.As(err, &appErr):
+		writeJSON(w, errorStatus(appErr.Code), ErrorResponse{
+			Code:    appErr.Code,
+			Message: appErr.Message,
+			Details: errorDetails(appErr.Details),
+		})
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		writeJSON(w, http.StatusGatewayTimeout, ErrorResponse{
+			Code:    apperr.CodeTimeout,
+			Message: "request timed out",
+		})
+	default:
+		log.Print("Internal error", "error", err)
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{
+			Code:    apperr.CodeInternal,
+			Message: "internal server error",
+		})
+	}
+}
+
+func errorStatus(code apperr.Code) int {
+	switch code {
+	case apperr.CodeValidation:
+		return http.StatusBadRequest
+	case apperr.CodeNotFound:
+		return http.StatusNotFound
+	case apperr.CodeConflict, apperr.CodeInsufficientStock:
+		return http.StatusConflict
+	case apperr.CodePreconditionFailed:
+		return http.StatusPreconditionFailed
+	case apperr.CodePreconditionRequired:
+		return http.StatusPreconditionRequired
+	case apperr.CodeIdempotencyMismatch:
+		return http.StatusUnprocessableEntity
+	case apperr.CodeTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
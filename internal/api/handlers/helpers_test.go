@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/apperr"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestWriteErrorAfterDeadline(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want int
+	}{
+		{"deadline exceeded", context.Background(), context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{"cancelled query", expired, errors.New("pq: canceling statement due to user request"), http.StatusGatewayTimeout},
+		{"rolled back transaction", expired, sql.ErrTxDone, http.StatusGatewayTimeout},
+		{"domain error", expired, apperr.NotFound("order not found"), http.StatusNotFound},
+		{"internal error", context.Background(), sql.ErrTxDone, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(tt.ctx)
+			rec := httptest.NewRecorder()
+			writeError(rec, r, tt.err)
+			if rec.Code != tt.want {
+				t.Errorf("writeError(%v) wrote %d, want %d", tt.err, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONDecimalIsANumber(t *testing.T) {
+	body, err := json.Marshal(InventoryItemResponse{Quantity: JSONDecimal{decimal.RequireFromString("7.5")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"quantity":7.5`) {
+		t.Errorf("response encodes quantity as %s, want a number", body)
+	}
+
+	quoted, err := json.Marshal(decimal.RequireFromString("7.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(quoted) != `"7.5"` {
+		t.Errorf("decimal.Decimal encodes as %s, want the library default \"7.5\"", quoted)
+	}
+}
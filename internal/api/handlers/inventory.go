@@ -2,13 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"frappuccino/internal/apperr"
 	"frappuccino/internal/service"
 	"frappuccino/models"
 	"log"
-	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type InventoryHandler struct {
@@ -20,185 +21,243 @@ func NewInventoryHandler(svc service.InventoryService) *InventoryHandler {
 }
 
 func (h *InventoryHandler) CreateInventoryItem(w http.ResponseWriter, r *http.Request) {
-	var itemReq struct {
-		Name     string `json:"name"`
-		Quantity int    `json:"quantity"`
-		Unit     string `json:"unit"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&itemReq); err != nil {
+	var req InventoryItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Print("Failed to decode request body", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid request body"))
 		return
 	}
 
-	createdItem, err := h.service.CreateInventoryItem(
-		itemReq.Name,
-		itemReq.Quantity,
-		itemReq.Unit,
-	)
+	createdItem, err := h.service.CreateInventoryItem(r.Context(), req.toModel())
 	if err != nil {
 		log.Print("Failed to create inventory item", "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(createdItem); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	setETag(w, createdItem.Version)
+	writeJSON(w, http.StatusCreated, newInventoryItemResponse(createdItem))
 }
 
 func (h *InventoryHandler) GetInventoryItems(w http.ResponseWriter, r *http.Request) {
-	items, err := h.service.GetInventoryItems()
+	query := r.URL.Query()
+	page, cursor, err := parsePageRequest(query)
 	if err != nil {
-		log.Print("Failed to get inventory items", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	filter := models.InventoryFilter{Unit: query.Get("unit")}
+	if s := query.Get("low_stock"); s != "" {
+		if filter.LowStock, err = strconv.ParseBool(s); err != nil {
+			writeError(w, r, apperr.Validation("invalid low_stock %q", s))
+			return
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(items); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	items, next, err := h.service.GetInventoryItems(r.Context(), filter, page, cursor)
+	if err != nil {
+		log.Print("Failed to get inventory items", "error", err)
+		writeError(w, r, err)
+		return
 	}
+
+	writeJSON(w, http.StatusOK, newListResponse(newInventoryItemResponses(items), next))
 }
 
 func (h *InventoryHandler) GetInventoryItem(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/inventory/{")
-	n = strings.TrimSuffix(n, "}")
-	id, err := strconv.ParseInt(n, 10, 64)
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid inventory item ID"))
 		return
 	}
 
 	if id == 0 {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("inventory item ID is required"))
 		return
 	}
 
-	item, err := h.service.GetInventoryItem(id)
+	item, err := h.service.GetInventoryItem(r.Context(), id)
 	if err != nil {
 		log.Print("Failed to get inventory item", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(item); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	setETag(w, item.Version)
+	writeJSON(w, http.StatusOK, newInventoryItemResponse(item))
 }
 
 func (h *InventoryHandler) UpdateInventoryItem(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/inventory/{")
-	n = strings.TrimSuffix(n, "}")
-	id, err := strconv.ParseInt(n, 10, 64)
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid inventory item ID"))
 		return
 	}
 	if id == 0 {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("inventory item ID is required"))
 		return
 	}
 
-	var item models.InventoryItem
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+	var req InventoryItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Print("Failed to decode request body", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid request body"))
 		return
 	}
 
-	if item.IngredientID != id {
-		http.Error(w, "ID in path doesn't match ID in body", http.StatusBadRequest)
+	update := req.toUpdate(id)
+	if update.Version, err = requireIfMatch(r); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	updatedItem, err := h.service.UpdateInventoryItem(item)
+	updatedItem, err := h.service.UpdateInventoryItem(r.Context(), update)
 	if err != nil {
 		log.Print("Failed to update inventory item", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(updatedItem); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	setETag(w, updatedItem.Version)
+	writeJSON(w, http.StatusOK, newInventoryItemResponse(updatedItem))
 }
 
 func (h *InventoryHandler) DeleteInventoryItem(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/inventory/{")
-	n = strings.TrimSuffix(n, "}")
-	id, err := strconv.ParseInt(n, 10, 64)
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid inventory item ID"))
 		return
 	}
 
 	if id == 0 {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("inventory item ID is required"))
+		return
+	}
+
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	if err := h.service.DeleteInventoryItem(id); err != nil {
+	var deletion models.InventoryDeletion
+	query := r.URL.Query()
+	if s := query.Get("force"); s != "" {
+		if deletion.Force, err = strconv.ParseBool(s); err != nil {
+			writeError(w, r, apperr.Validation("invalid force %q", s))
+			return
+		}
+	}
+	if s := query.Get("replacement_id"); s != "" {
+		if deletion.ReplacementID, err = strconv.ParseInt(s, 10, 64); err != nil {
+			writeError(w, r, apperr.Validation("invalid replacement_id %q", s))
+			return
+		}
+	}
+
+	if err := h.service.DeleteInventoryItem(r.Context(), id, version, deletion); err != nil {
 		log.Print("Failed to delete inventory item", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *InventoryHandler) GetLeftOversHandler(w http.ResponseWriter, r *http.Request) {
-	sortBy := r.URL.Query().Get("sortBy")
-	pageStr := r.URL.Query().Get("page")
-	pageSizeStr := r.URL.Query().Get("pageSize")
+func (h *InventoryHandler) PurchaseInventory(w http.ResponseWriter, r *http.Request) {
+	h.recordMovement(w, r, models.TransactionPurchase)
+}
+
+func (h *InventoryHandler) WasteInventory(w http.ResponseWriter, r *http.Request) {
+	h.recordMovement(w, r, models.TransactionWaste)
+}
+
+func (h *InventoryHandler) AdjustInventory(w http.ResponseWriter, r *http.Request) {
+	h.recordMovement(w, r, models.TransactionAdjustment)
+}
+
+func (h *InventoryHandler) recordMovement(w http.ResponseWriter, r *http.Request, kind models.TransactionType) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, apperr.Validation("invalid inventory item ID"))
+		return
+	}
 
-	page, _ := strconv.Atoi(pageStr)
-	pageSize, _ := strconv.Atoi(pageSizeStr)
-	if page < 1 {
-		page = 1
+	var movementReq InventoryMovementRequest
+	if err := json.NewDecoder(r.Body).Decode(&movementReq); err != nil {
+		log.Print("Failed to decode request body", "error", err)
+		writeError(w, r, apperr.Validation("invalid request body"))
+		return
 	}
-	if pageSize < 1 {
-		pageSize = 10
+
+	item, err := h.service.RecordMovement(r.Context(), id, kind, movementReq.Delta, movementReq.UnitCost, movementReq.Note)
+	if err != nil {
+		log.Print("Failed to record inventory movement", "id", id, "type", kind, "error", err)
+		writeError(w, r, err)
+		return
 	}
 
-	items, total, err := h.service.GetLeftOvers(sortBy, page, pageSize)
+	setETag(w, item.Version)
+	writeJSON(w, http.StatusOK, newInventoryItemResponse(item))
+}
+
+func (h *InventoryHandler) GetInventoryTransactions(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Error fetching leftovers", http.StatusInternalServerError)
+		writeError(w, r, apperr.Validation("invalid inventory item ID"))
 		return
 	}
 
-	type ResponseItem struct {
-		Name     string `json:"name"`
-		Quantity int    `json:"quantity"`
+	query := r.URL.Query()
+	startDate := query.Get("startDate")
+	endDate := query.Get("endDate")
+	if startDate != "" {
+		if _, err := time.Parse("2006-01-02", startDate); err != nil {
+			writeError(w, r, apperr.Validation("invalid startDate format. Use YYYY-MM-DD"))
+			return
+		}
+	}
+	if endDate != "" {
+		if _, err := time.Parse("2006-01-02", endDate); err != nil {
+			writeError(w, r, apperr.Validation("invalid endDate format. Use YYYY-MM-DD"))
+			return
+		}
+	}
+
+	page, pageSize, err := parsePageParams(query)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	var responseData []ResponseItem
-	for _, item := range items {
-		responseData = append(responseData, ResponseItem{
-			Name:     item.Name,
-			Quantity: item.Quantity,
-		})
+
+	transactions, total, err := h.service.GetTransactions(r.Context(), id, startDate, endDate, page, pageSize)
+	if err != nil {
+		log.Print("Failed to get inventory transactions", "id", id, "error", err)
+		writeError(w, r, err)
+		return
 	}
 
-	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
-	hasNext := page < totalPages
+	writeJSON(w, http.StatusOK, newPageResponse(newInventoryTransactionResponses(transactions), page, pageSize, total))
+}
+
+func (h *InventoryHandler) GetLeftOversHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sortBy := query.Get("sortBy")
+	desc := strings.HasPrefix(sortBy, "-")
+	sortBy = strings.TrimPrefix(sortBy, "-")
 
-	resp := map[string]interface{}{
-		"currentPage": page,
-		"hasNextPage": hasNext,
-		"pageSize":    pageSize,
-		"totalPages":  totalPages,
-		"data":        responseData,
+	page, pageSize, err := parsePageParams(query)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	levels, total, err := h.service.GetLeftOvers(r.Context(), sortBy, desc, page, pageSize)
+	if err != nil {
+		log.Print("Failed to fetch leftovers", "error", err)
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	writeJSON(w, http.StatusOK, newPageResponse(newLeftOverResponses(levels), page, pageSize, total))
 }
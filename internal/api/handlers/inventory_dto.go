@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"frappuccino/models"
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type InventoryItemRequest struct {
+	Name         string           `json:"name"`
+	Quantity     *decimal.Decimal `json:"quantity,omitempty"`
+	Unit         string           `json:"unit"`
+	ReorderLevel *decimal.Decimal `json:"reorder_level,omitempty"`
+	CostPerUnit  *float64         `json:"cost_per_unit,omitempty"`
+}
+
+type InventoryMovementRequest struct {
+	Delta    decimal.Decimal `json:"delta"`
+	UnitCost *float64        `json:"unit_cost,omitempty"`
+	Note     string          `json:"note,omitempty"`
+}
+
+type InventoryItemResponse struct {
+	ID           int64       `json:"id"`
+	Name         string      `json:"name"`
+	Quantity     JSONDecimal `json:"quantity"`
+	Unit         string      `json:"unit"`
+	ReorderLevel JSONDecimal `json:"reorder_level"`
+	CostPerUnit  float64     `json:"cost_per_unit"`
+	Version      int64       `json:"version"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+type InventoryTransactionResponse struct {
+	ID             int64       `json:"id"`
+	QuantityChange JSONDecimal `json:"quantity_change"`
+	Unit           string      `json:"unit"`
+	Type           string      `json:"transaction_type"`
+	Reason         string      `json:"reason,omitempty"`
+	OrderID        int64       `json:"order_id,omitempty"`
+	UnitCost       *float64    `json:"unit_cost,omitempty"`
+	Date           time.Time   `json:"transaction_date"`
+}
+
+type LeftOverResponse struct {
+	IngredientID     int64       `json:"ingredient_id"`
+	Name             string      `json:"name"`
+	Quantity         JSONDecimal `json:"quantity"`
+	Unit             string      `json:"unit"`
+	CostPerUnit      float64     `json:"cost_per_unit"`
+	StockValue       float64     `json:"stock_value"`
+	DailyConsumption float64     `json:"daily_consumption"`
+	DaysOfCover      *float64    `json:"days_of_cover"`
+}
+
+type PageResponse[T any] struct {
+	CurrentPage int  `json:"currentPage"`
+	HasNextPage bool `json:"hasNextPage"`
+	PageSize    int  `json:"pageSize"`
+	TotalPages  int  `json:"totalPages"`
+	Data        []T  `json:"data"`
+}
+
+func newPageResponse[T any](data []T, page, pageSize, total int) PageResponse[T] {
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+	return PageResponse[T]{
+		CurrentPage: page,
+		HasNextPage: page < totalPages,
+		PageSize:    pageSize,
+		TotalPages:  totalPages,
+		Data:        data,
+	}
+}
+
+func (req InventoryItemRequest) toModel() models.InventoryItem {
+	quantity := decimal.Zero
+	if req.Quantity != nil {
+		quantity = *req.Quantity
+	}
+	item := models.NewInventoryItem(req.Name, quantity, req.Unit)
+	if req.ReorderLevel != nil {
+		item.ReorderLevel = *req.ReorderLevel
+	}
+	if req.CostPerUnit != nil {
+		item.CostPerUnit = *req.CostPerUnit
+	}
+	return item
+}
+
+func (req InventoryItemRequest) toUpdate(id int64) models.InventoryUpdate {
+	return models.InventoryUpdate{
+		IngredientID: id,
+		Name:         req.Name,
+		Quantity:     req.Quantity,
+		Unit:         req.Unit,
+		ReorderLevel: req.ReorderLevel,
+		CostPerUnit:  req.CostPerUnit,
+	}
+}
+
+func newInventoryItemResponse(item models.InventoryItem) InventoryItemResponse {
+	return InventoryItemResponse{
+		ID:           item.IngredientID,
+		Name:         item.Name,
+		Quantity:     JSONDecimal{item.Quantity},
+		Unit:         item.Unit,
+		ReorderLevel: JSONDecimal{item.ReorderLevel},
+		CostPerUnit:  item.CostPerUnit,
+		Version:      item.Version,
+		CreatedAt:    item.CreatedAt,
+		UpdatedAt:    item.UpdatedAt,
+	}
+}
+
+func newInventoryItemResponses(items []models.InventoryItem) []InventoryItemResponse {
+	resp := make([]InventoryItemResponse, 0, len(items))
+	for _, item := range items {
+		resp = append(resp, newInventoryItemResponse(item))
+	}
+	return resp
+}
+
+func newInventoryTransactionResponses(transactions []models.InventoryTransaction) []InventoryTransactionResponse {
+	resp := make([]InventoryTransactionResponse, 0, len(transactions))
+	for _, t := range transactions {
+		resp = append(resp, InventoryTransactionResponse{
+			ID:             t.ID,
+			QuantityChange: JSONDecimal{t.QuantityChange},
+			Unit:           t.Unit,
+			Type:           string(t.Type),
+			Reason:         t.Reason,
+			OrderID:        t.OrderID,
+			UnitCost:       t.UnitCost,
+			Date:           t.CreatedAt,
+		})
+	}
+	return resp
+}
+
+func newLeftOverResponses(levels []models.StockLevel) []LeftOverResponse {
+	resp := make([]LeftOverResponse, 0, len(levels))
+	for _, level := range levels {
+		resp = append(resp, LeftOverResponse{
+			IngredientID:     level.IngredientID,
+			Name:             level.Name,
+			Quantity:         JSONDecimal{level.Quantity},
+			Unit:             level.Unit,
+			CostPerUnit:      level.CostPerUnit,
+			StockValue:       level.Value,
+			DailyConsumption: level.DailyConsumption,
+			DaysOfCover:      level.DaysOfCover,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"frappuccino/internal/apperr"
+	"frappuccino/models"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ListResponse[T any] struct {
+	Data       []T     `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+func newListResponse[T any](data []T, nextCursor string) ListResponse[T] {
+	resp := ListResponse[T]{Data: data}
+	if nextCursor != "" {
+		resp.NextCursor = &nextCursor
+	}
+	return resp
+}
+
+func parsePageRequest(query url.Values) (models.PageRequest, string, error) {
+	var page models.PageRequest
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil {
+			return models.PageRequest{}, "", apperr.Validation("invalid limit %q", s)
+		}
+		page.Limit = limit
+	}
+	page.Sort = query.Get("sort")
+	if strings.HasPrefix(page.Sort, "-") {
+		page.Sort, page.Desc = page.Sort[1:], true
+	}
+	return page, query.Get("cursor"), nil
+}
+
+func parsePageParams(query url.Values) (page, pageSize int, err error) {
+	page, pageSize = 1, 10
+	if s := query.Get("page"); s != "" {
+		if page, err = strconv.Atoi(s); err != nil {
+			return 0, 0, apperr.Validation("invalid page %q", s)
+		}
+	}
+	if s := query.Get("pageSize"); s != "" {
+		if pageSize, err = strconv.Atoi(s); err != nil {
+			return 0, 0, apperr.Validation("invalid pageSize %q", s)
+		}
+	}
+	return page, pageSize, nil
+}
+
+// parseTimeParam moves a bare date to the start of the next day with endOfDay
+// set, so an exclusive upper bound still covers the whole date.
+func parseTimeParam(query url.Values, name string, endOfDay bool) (time.Time, error) {
+	s := query.Get(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, apperr.Validation("invalid %s %q. Use YYYY-MM-DD or RFC 3339", name, s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func parseFloatParam(query url.Values, name string) (*float64, error) {
+	s := query.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, apperr.Validation("invalid %s %q", name, s)
+	}
+	return &f, nil
+}
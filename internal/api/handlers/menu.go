@@ -2,12 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"frappuccino/internal/apperr"
 	"frappuccino/internal/service"
 	"frappuccino/models"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 type MenuHandler struct {
@@ -19,126 +19,190 @@ func NewMenuHandler(svc service.MenuService) *MenuHandler {
 }
 
 func (h *MenuHandler) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
-	var item models.MenuItem
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+	var req MenuItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Print("Failed to decode request body", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid request body"))
 		return
 	}
 
-	createdItem, err := h.service.CreateMenuItem(item)
+	createdItem, err := h.service.CreateMenuItem(r.Context(), req.toModel())
 	if err != nil {
 		log.Print("Failed to create menu item", "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(createdItem); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	setETag(w, createdItem.Version)
+	writeJSON(w, http.StatusCreated, newMenuItemResponse(createdItem))
 }
 
 func (h *MenuHandler) GetMenuItems(w http.ResponseWriter, r *http.Request) {
-	items, err := h.service.GetMenuItems()
+	query := r.URL.Query()
+	page, cursor, err := parsePageRequest(query)
 	if err != nil {
-		log.Print("Failed to get menu items", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+	filter := models.MenuFilter{Category: query.Get("category")}
+	if s := query.Get("include_archived"); s != "" {
+		if filter.IncludeArchived, err = strconv.ParseBool(s); err != nil {
+			writeError(w, r, apperr.Validation("invalid include_archived %q", s))
+			return
+		}
+	}
+	if filter.MinPrice, err = parseFloatParam(query, "min_price"); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if filter.MaxPrice, err = parseFloatParam(query, "max_price"); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(items); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	items, next, err := h.service.GetMenuItems(r.Context(), filter, page, cursor)
+	if err != nil {
+		log.Print("Failed to get menu items", "error", err)
+		writeError(w, r, err)
+		return
 	}
+
+	writeJSON(w, http.StatusOK, newListResponse(newMenuItemResponses(items), next))
 }
 
 func (h *MenuHandler) GetMenuItem(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/menu/{")
-	n = strings.TrimSuffix(n, "}")
-	id, err := strconv.ParseInt(n, 10, 64)
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid menu item ID"))
 		return
 	}
 	if id == 0 {
-		http.Error(w, "Menu item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("menu item ID is required"))
 		return
 	}
 
-	item, err := h.service.GetMenuItem(id)
+	item, err := h.service.GetMenuItem(r.Context(), id)
 	if err != nil {
 		log.Print("Failed to get menu item", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(item); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	setETag(w, item.Version)
+	writeJSON(w, http.StatusOK, newMenuItemResponse(item))
 }
 
 func (h *MenuHandler) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/menu/{")
-	n = strings.TrimSuffix(n, "}")
-
-	id, err := strconv.ParseInt(n, 10, 64)
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid menu item ID"))
 		return
 	}
 
 	if id == 0 {
-		http.Error(w, "Menu item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("menu item ID is required"))
 		return
 	}
 
-	var item models.MenuItem
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+	var req MenuItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Print("Failed to decode request body", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid request body"))
 		return
 	}
 
-	updatedItem, err := h.service.UpdateMenuItem(id, item)
+	item := req.toModel()
+	item.ID = id
+	if item.Version, err = requireIfMatch(r); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	updatedItem, err := h.service.UpdateMenuItem(r.Context(), id, item)
 	if err != nil {
 		log.Print("Failed to update menu item", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(updatedItem); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	setETag(w, updatedItem.Version)
+	writeJSON(w, http.StatusOK, newMenuItemResponse(updatedItem))
 }
 
-func (h *MenuHandler) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/menu/{")
-	n = strings.TrimSuffix(n, "}")
-
-	id, err := strconv.ParseInt(n, 10, 64)
+func (h *MenuHandler) ArchiveMenuItem(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid menu item ID"))
 		return
 	}
 
 	if id == 0 {
-		http.Error(w, "Menu item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("menu item ID is required"))
 		return
 	}
 
-	if err := h.service.DeleteMenuItem(id); err != nil {
-		log.Print("Failed to delete menu item", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.service.ArchiveMenuItem(r.Context(), id, version); err != nil {
+		log.Print("Failed to archive menu item", "id", id, "error", err)
+		writeError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *MenuHandler) RestoreMenuItem(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, apperr.Validation("invalid menu item ID"))
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	item, err := h.service.RestoreMenuItem(r.Context(), id, version)
+	if err != nil {
+		log.Print("Failed to restore menu item", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, item.Version)
+	writeJSON(w, http.StatusOK, newMenuItemResponse(item))
+}
+
+func (h *MenuHandler) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, apperr.Validation("invalid menu item ID"))
+		return
+	}
+
+	history, err := h.service.GetPriceHistory(r.Context(), id)
+	if err != nil {
+		log.Print("Failed to get price history", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newPriceChangeResponses(history))
+}
+
+func (h *MenuHandler) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	availability, err := h.service.GetAvailability(r.Context())
+	if err != nil {
+		log.Print("Failed to get menu availability", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newMenuAvailabilityResponses(availability))
+}
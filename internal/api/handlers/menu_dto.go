@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"frappuccino/models"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type MenuItemRequest struct {
+	Name        string                      `json:"name"`
+	Description string                      `json:"description,omitempty"`
+	Categories  []string                    `json:"categories,omitempty"`
+	Price       float64                     `json:"price"`
+	Ingredients []MenuItemIngredientRequest `json:"ingredients,omitempty"`
+}
+
+type MenuItemIngredientRequest struct {
+	IngredientID int64           `json:"ingredient_id"`
+	Quantity     decimal.Decimal `json:"quantity"`
+	Unit         string          `json:"unit,omitempty"`
+}
+
+type MenuItemResponse struct {
+	ID                int64                        `json:"id"`
+	Name              string                       `json:"name"`
+	Description       string                       `json:"description"`
+	Categories        []string                     `json:"categories"`
+	Price             float64                      `json:"price"`
+	RecipeCost        float64                      `json:"recipe_cost"`
+	Ingredients       []MenuItemIngredientResponse `json:"ingredients"`
+	Modifiers         []ModifierResponse           `json:"modifiers,omitempty"`
+	AvailablePortions *int                         `json:"available_portions"`
+	ArchivedAt        *time.Time                   `json:"archived_at"`
+	Version           int64                        `json:"version"`
+}
+
+type MenuItemIngredientResponse struct {
+	IngredientID int64       `json:"ingredient_id"`
+	Name         string      `json:"name"`
+	Quantity     JSONDecimal `json:"quantity"`
+	Unit         string      `json:"unit"`
+}
+
+type PriceChangeResponse struct {
+	OldPrice  float64   `json:"old_price"`
+	NewPrice  float64   `json:"new_price"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type MenuAvailabilityResponse struct {
+	ProductID            int64  `json:"product_id"`
+	Name                 string `json:"name"`
+	AvailablePortions    *int   `json:"available_portions"`
+	Available            bool   `json:"available"`
+	LimitingIngredientID int64  `json:"limiting_ingredient_id,omitempty"`
+	LimitingIngredient   string `json:"limiting_ingredient,omitempty"`
+}
+
+func (req MenuItemRequest) toModel() models.MenuItem {
+	item := models.MenuItem{
+		Name:        req.Name,
+		Description: req.Description,
+		Categories:  req.Categories,
+		Price:       req.Price,
+		Ingredients: make([]models.MenuItemIngredient, 0, len(req.Ingredients)),
+	}
+	for _, ing := range req.Ingredients {
+		item.Ingredients = append(item.Ingredients, models.MenuItemIngredient{
+			IngredientID: ing.IngredientID,
+			Quantity:     ing.Quantity,
+			Unit:         ing.Unit,
+		})
+	}
+	return item
+}
+
+func newMenuItemResponse(item models.MenuItem) MenuItemResponse {
+	resp := MenuItemResponse{
+		ID:                item.ID,
+		Name:              item.Name,
+		Description:       item.Description,
+		Categories:        item.Categories,
+		Price:             item.Price,
+		RecipeCost:        item.Cost(),
+		Ingredients:       make([]MenuItemIngredientResponse, 0, len(item.Ingredients)),
+		AvailablePortions: item.AvailablePortions,
+		ArchivedAt:        item.ArchivedAt,
+		Version:           item.Version,
+	}
+	if resp.Categories == nil {
+		resp.Categories = []string{}
+	}
+	for _, ing := range item.Ingredients {
+		resp.Ingredients = append(resp.Ingredients, MenuItemIngredientResponse{
+			IngredientID: ing.IngredientID,
+			Name:         ing.ProductName,
+			Quantity:     JSONDecimal{ing.Quantity},
+			Unit:         ing.Unit,
+		})
+	}
+	if len(item.Modifiers) > 0 {
+		resp.Modifiers = newModifierResponses(item.Modifiers)
+	}
+	return resp
+}
+
+func newMenuItemResponses(items []models.MenuItem) []MenuItemResponse {
+	resp := make([]MenuItemResponse, 0, len(items))
+	for _, item := range items {
+		resp = append(resp, newMenuItemResponse(item))
+	}
+	return resp
+}
+
+func newPriceChangeResponses(history []models.PriceChange) []PriceChangeResponse {
+	resp := make([]PriceChangeResponse, 0, len(history))
+	for _, change := range history {
+		resp = append(resp, PriceChangeResponse{
+			OldPrice:  change.OldPrice,
+			NewPrice:  change.NewPrice,
+			ChangedAt: change.ChangedAt,
+		})
+	}
+	return resp
+}
+
+func newMenuAvailabilityResponses(availability []models.MenuItemAvailability) []MenuAvailabilityResponse {
+	resp := make([]MenuAvailabilityResponse, 0, len(availability))
+	for _, a := range availability {
+		resp = append(resp, MenuAvailabilityResponse{
+			ProductID:            a.ProductID,
+			Name:                 a.ProductName,
+			AvailablePortions:    a.AvailablePortions,
+			Available:            a.Available(),
+			LimitingIngredientID: a.LimitingIngredientID,
+			LimitingIngredient:   a.LimitingIngredient,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"frappuccino/internal/apperr"
+	"frappuccino/internal/service"
+	"log"
+	"net/http"
+)
+
+type ModifierHandler struct {
+	service service.ModifierService
+}
+
+func NewModifierHandler(svc service.ModifierService) *ModifierHandler {
+	return &ModifierHandler{service: svc}
+}
+
+func (h *ModifierHandler) CreateModifier(w http.ResponseWriter, r *http.Request) {
+	var req ModifierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Print("Failed to decode request body", "error", err)
+		writeError(w, r, apperr.Validation("invalid request body"))
+		return
+	}
+
+	created, err := h.service.CreateModifier(r.Context(), req.toModel())
+	if err != nil {
+		log.Print("Failed to create modifier", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newModifierResponse(created))
+}
+
+func (h *ModifierHandler) GetModifiers(w http.ResponseWriter, r *http.Request) {
+	modifiers, err := h.service.GetModifiers(r.Context())
+	if err != nil {
+		log.Print("Failed to get modifiers", "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newModifierResponses(modifiers))
+}
+
+func (h *ModifierHandler) GetModifier(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, apperr.Validation("invalid modifier ID"))
+		return
+	}
+
+	modifier, err := h.service.GetModifier(r.Context(), id)
+	if err != nil {
+		log.Print("Failed to get modifier", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newModifierResponse(modifier))
+}
+
+func (h *ModifierHandler) UpdateModifier(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, apperr.Validation("invalid modifier ID"))
+		return
+	}
+
+	var req ModifierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Print("Failed to decode request body", "error", err)
+		writeError(w, r, apperr.Validation("invalid request body"))
+		return
+	}
+
+	updated, err := h.service.UpdateModifier(r.Context(), id, req.toModel())
+	if err != nil {
+		log.Print("Failed to update modifier", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newModifierResponse(updated))
+}
+
+func (h *ModifierHandler) DeleteModifier(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, apperr.Validation("invalid modifier ID"))
+		return
+	}
+
+	if err := h.service.DeleteModifier(r.Context(), id); err != nil {
+		log.Print("Failed to delete modifier", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
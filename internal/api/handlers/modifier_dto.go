@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"frappuccino/models"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ModifierRequest is the body of POST /modifiers and PUT /modifiers/{id}.
+type ModifierRequest struct {
+	Name                   string                      `json:"name"`
+	Kind                   string                      `json:"kind"`
+	PriceDelta             float64                     `json:"price_delta"`
+	ReplacesIngredientID   int64                       `json:"replaces_ingredient_id,omitempty"`
+	SubstituteIngredientID int64                       `json:"substitute_ingredient_id,omitempty"`
+	Ingredients            []ModifierIngredientRequest `json:"ingredients,omitempty"`
+	Categories             []string                    `json:"categories,omitempty"`
+	ProductIDs             []int64                     `json:"product_ids,omitempty"`
+}
+
+type ModifierIngredientRequest struct {
+	IngredientID int64           `json:"ingredient_id"`
+	Quantity     decimal.Decimal `json:"quantity"`
+}
+
+type ModifierResponse struct {
+	ID                     int64                        `json:"id"`
+	Name                   string                       `json:"name"`
+	Kind                   string                       `json:"kind"`
+	PriceDelta             float64                      `json:"price_delta"`
+	ReplacesIngredientID   int64                        `json:"replaces_ingredient_id,omitempty"`
+	SubstituteIngredientID int64                        `json:"substitute_ingredient_id,omitempty"`
+	Ingredients            []ModifierIngredientResponse `json:"ingredients,omitempty"`
+	Categories             []string                     `json:"categories,omitempty"`
+	ProductIDs             []int64                      `json:"product_ids,omitempty"`
+	CreatedAt              time.Time                    `json:"created_at"`
+	UpdatedAt              time.Time                    `json:"updated_at"`
+}
+
+type ModifierIngredientResponse struct {
+	IngredientID int64       `json:"ingredient_id"`
+	Name         string      `json:"name"`
+	Quantity     JSONDecimal `json:"quantity"`
+}
+
+func (req ModifierRequest) toModel() models.Modifier {
+	m := models.Modifier{
+		Name:                   req.Name,
+		Kind:                   models.ModifierKind(req.Kind),
+		PriceDelta:             req.PriceDelta,
+		ReplacesIngredientID:   req.ReplacesIngredientID,
+		SubstituteIngredientID: req.SubstituteIngredientID,
+		Categories:             req.Categories,
+		ProductIDs:             req.ProductIDs,
+	}
+	if m.Categories == nil {
+		// modifiers.categories is NOT NULL, and a nil slice is sent as NULL.
+		m.Categories = []string{}
+	}
+	for _, ing := range req.Ingredients {
+		m.Ingredients = append(m.Ingredients, models.ModifierIngredient{
+			IngredientID: ing.IngredientID,
+			Quantity:     ing.Quantity,
+		})
+	}
+	return m
+}
+
+func newModifierResponse(m models.Modifier) ModifierResponse {
+	resp := ModifierResponse{
+		ID:                     m.ID,
+		Name:                   m.Name,
+		Kind:                   string(m.Kind),
+		PriceDelta:             m.PriceDelta,
+		ReplacesIngredientID:   m.ReplacesIngredientID,
+		SubstituteIngredientID: m.SubstituteIngredientID,
+		Categories:             m.Categories,
+		ProductIDs:             m.ProductIDs,
+		CreatedAt:              m.CreatedAt,
+		UpdatedAt:              m.UpdatedAt,
+	}
+	for _, ing := range m.Ingredients {
+		resp.Ingredients = append(resp.Ingredients, ModifierIngredientResponse{
+			IngredientID: ing.IngredientID,
+			Name:         ing.ProductName,
+			Quantity:     JSONDecimal{ing.Quantity},
+		})
+	}
+	return resp
+}
+
+func newModifierResponses(modifiers []models.Modifier) []ModifierResponse {
+	resp := make([]ModifierResponse, 0, len(modifiers))
+	for _, m := range modifiers {
+		resp = append(resp, newModifierResponse(m))
+	}
+	return resp
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"context"
+	"frappuccino/internal/service"
+	"frappuccino/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordingModifierService struct {
+	service.ModifierService
+	created models.Modifier
+}
+
+func (s *recordingModifierService) CreateModifier(ctx context.Context, m models.Modifier) (models.Modifier, error) {
+	s.created = m
+	m.ID = 1
+	return m, nil
+}
+
+func TestCreateModifierWithoutCategories(t *testing.T) {
+	svc := &recordingModifierService{}
+	body := `{"name": "Extra shot", "kind": "add", "price_delta": 0.5, "ingredients": [{"ingredient_id": 1, "quantity": 7}]}`
+	rec := httptest.NewRecorder()
+	NewModifierHandler(svc).CreateModifier(rec, httptest.NewRequest(http.MethodPost, "/modifiers", strings.NewReader(body)))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /modifiers returned %d: %s", rec.Code, rec.Body)
+	}
+	if svc.created.Categories == nil {
+		t.Error("categories are nil, which the repository stores as NULL")
+	}
+}
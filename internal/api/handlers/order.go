@@ -1,178 +1,341 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"frappuccino/internal/apperr"
 	"frappuccino/internal/service"
 	"frappuccino/models"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 )
 
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type OrderHandler struct {
-	service service.OrderService
+	service     service.OrderService
+	idempotency service.IdempotencyService
 }
 
-func NewOrderHandler(svc service.OrderService) *OrderHandler {
-	return &OrderHandler{service: svc}
+func NewOrderHandler(svc service.OrderService, idempotency service.IdempotencyService) *OrderHandler {
+	return &OrderHandler{service: svc, idempotency: idempotency}
 }
 
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
-	var order models.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+	var req OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Print("Failed to decode request body", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid request body"))
 		return
 	}
 
-	createdOrder, err := h.service.CreateOrder(order)
+	var idempotent *service.IdempotentResponse
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		record, err := h.idempotency.Begin(r.Context(), key, req)
+		if err != nil {
+			log.Print("Failed to look up idempotency key", "key", key, "error", err)
+			writeError(w, r, err)
+			return
+		}
+		if record.StatusCode != 0 {
+			replay(w, record)
+			return
+		}
+		idempotent = &service.IdempotentResponse{
+			Key:         record.Key,
+			RequestHash: record.RequestHash,
+			StatusCode:  http.StatusCreated,
+			Render:      renderOrder,
+		}
+	}
+
+	createdOrder, err := h.service.CreateOrder(r.Context(), req.toModel(), idempotent)
+	if errors.Is(err, service.ErrIdempotencyKeyTaken) {
+		// A concurrent retry placed the order first; answer with its response.
+		var record models.IdempotencyRecord
+		if record, err = h.idempotency.Begin(r.Context(), idempotent.Key, req); err == nil {
+			if record.StatusCode != 0 {
+				replay(w, record)
+				return
+			}
+			err = apperr.Conflict("a request with Idempotency-Key %q is still being processed", idempotent.Key)
+		}
+	}
 	if err != nil {
 		log.Print("Failed to create order", "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	body, err := renderOrder(createdOrder)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
+	setETag(w, createdOrder.Version)
+	writeRawJSON(w, http.StatusCreated, body)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(createdOrder); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+func renderOrder(order models.Order) ([]byte, error) {
+	return json.Marshal(newOrderResponse(order))
+}
+
+func replay(w http.ResponseWriter, record models.IdempotencyRecord) {
+	var order OrderResponse
+	if err := json.Unmarshal(record.Body, &order); err == nil {
+		setETag(w, order.Version)
 	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	writeRawJSON(w, record.StatusCode, record.Body)
 }
 
 func (h *OrderHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
-	orders, err := h.service.GetOrders()
+	query := r.URL.Query()
+	page, cursor, err := parsePageRequest(query)
 	if err != nil {
-		log.Print("Failed to get orders", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+	filter := models.OrderFilter{
+		Status:   models.OrderStatus(query.Get("status")),
+		Customer: query.Get("customer"),
+	}
+	if filter.From, err = parseTimeParam(query, "from", false); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if filter.To, err = parseTimeParam(query, "to", true); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(orders); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	orders, next, err := h.service.GetOrders(r.Context(), filter, page, cursor)
+	if err != nil {
+		log.Print("Failed to get orders", "error", err)
+		writeError(w, r, err)
+		return
 	}
+
+	writeJSON(w, http.StatusOK, newListResponse(newOrderResponses(orders), next))
 }
 
 func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/orders/{")
-	n = strings.TrimSuffix(n, "}")
-
-	id, err := strconv.ParseInt(n, 10, 64)
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid order ID"))
 		return
 	}
 
 	if id == 0 {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("order ID is required"))
 		return
 	}
 
-	order, err := h.service.GetOrder(id)
+	order, err := h.service.GetOrder(r.Context(), id)
 	if err != nil {
 		log.Print("Failed to get order", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(order); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	setETag(w, order.Version)
+	writeJSON(w, http.StatusOK, newOrderResponse(order))
 }
 
 func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/orders/{")
-	n = strings.TrimSuffix(n, "}")
-
-	id, err := strconv.ParseInt(n, 10, 64)
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid order ID"))
 		return
 	}
 
 	if id == 0 {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("order ID is required"))
 		return
 	}
 
-	var order models.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+	var req OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Print("Failed to decode request body", "error", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid request body"))
 		return
 	}
 
-	updatedOrder, err := h.service.UpdateOrder(id, order)
+	order := req.toModel()
+	if order.Version, err = requireIfMatch(r); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	updatedOrder, err := h.service.UpdateOrder(r.Context(), id, order)
 	if err != nil {
 		log.Print("Failed to update order", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, updatedOrder.Version)
+	writeJSON(w, http.StatusOK, newOrderResponse(updatedOrder))
+}
+
+func (h *OrderHandler) AddOrderItem(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, apperr.Validation("invalid order ID"))
+		return
+	}
+
+	var req OrderItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Print("Failed to decode request body", "error", err)
+		writeError(w, r, apperr.Validation("invalid request body"))
+		return
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	order, err := h.service.AddOrderItem(r.Context(), id, req.toModel(), version)
+	if err != nil {
+		log.Print("Failed to add order item", "id", id, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, order.Version)
+	writeJSON(w, http.StatusCreated, newOrderResponse(order))
+}
+
+func (h *OrderHandler) UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
+	id, itemID, err := orderItemPath(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var req OrderItemQuantityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Print("Failed to decode request body", "error", err)
+		writeError(w, r, apperr.Validation("invalid request body"))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(updatedOrder); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	order, err := h.service.UpdateOrderItem(r.Context(), id, itemID, req.Quantity, version)
+	if err != nil {
+		log.Print("Failed to update order item", "id", id, "item_id", itemID, "error", err)
+		writeError(w, r, err)
+		return
 	}
+
+	setETag(w, order.Version)
+	writeJSON(w, http.StatusOK, newOrderResponse(order))
 }
 
-func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/orders/{")
-	n = strings.TrimSuffix(n, "}")
+func (h *OrderHandler) RemoveOrderItem(w http.ResponseWriter, r *http.Request) {
+	id, itemID, err := orderItemPath(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	order, err := h.service.RemoveOrderItem(r.Context(), id, itemID, version)
+	if err != nil {
+		log.Print("Failed to remove order item", "id", id, "item_id", itemID, "error", err)
+		writeError(w, r, err)
+		return
+	}
+
+	setETag(w, order.Version)
+	writeJSON(w, http.StatusOK, newOrderResponse(order))
+}
+
+func orderItemPath(r *http.Request) (int64, int64, error) {
+	id, err := pathID(r)
+	if err != nil {
+		return 0, 0, apperr.Validation("invalid order ID")
+	}
+	itemID, err := strconv.ParseInt(r.PathValue("item_id"), 10, 64)
+	if err != nil {
+		return 0, 0, apperr.Validation("invalid order item ID")
+	}
+	return id, itemID, nil
+}
 
-	id, err := strconv.ParseInt(n, 10, 64)
+func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid order ID"))
 		return
 	}
 
 	if id == 0 {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("order ID is required"))
+		return
+	}
+
+	version, err := requireIfMatch(r)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	if err := h.service.DeleteOrder(id); err != nil {
+	if err := h.service.DeleteOrder(r.Context(), id, version); err != nil {
 		log.Print("Failed to delete order", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *OrderHandler) StartOrder(w http.ResponseWriter, r *http.Request) {
+	h.transitionOrder(w, r, "start", h.service.StartOrder)
+}
+
 func (h *OrderHandler) CloseOrder(w http.ResponseWriter, r *http.Request) {
-	n := strings.TrimPrefix(r.URL.Path, "/orders/{")
-	n = strings.TrimSuffix(n, "}/close")
+	h.transitionOrder(w, r, "close", h.service.CloseOrder)
+}
 
-	id, err := strconv.ParseInt(n, 10, 64)
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	h.transitionOrder(w, r, "cancel", h.service.CancelOrder)
+}
+
+func (h *OrderHandler) transitionOrder(w http.ResponseWriter, r *http.Request, action string, apply func(ctx context.Context, id int64) (models.Order, error)) {
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, "Inventory item ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("invalid order ID"))
 		return
 	}
 
 	if id == 0 {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("order ID is required"))
 		return
 	}
 
-	order, err := h.service.CloseOrder(id)
+	order, err := apply(r.Context(), id)
 	if err != nil {
-		log.Print("Failed to close order", "id", id, "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Print("Failed to "+action+" order", "id", id, "error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(order); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	setETag(w, order.Version)
+	writeJSON(w, http.StatusOK, newOrderResponse(order))
 }
 
 func (h *OrderHandler) GetNumberOfOrderedItems(w http.ResponseWriter, r *http.Request) {
@@ -182,23 +345,23 @@ func (h *OrderHandler) GetNumberOfOrderedItems(w http.ResponseWriter, r *http.Re
 	// Проверка формата дат
 	if startDate != "" {
 		if _, err := time.Parse("2006-01-02", startDate); err != nil {
-			http.Error(w, "Invalid startDate format. Use YYYY-MM-DD", http.StatusBadRequest)
+			writeError(w, r, apperr.Validation("invalid startDate format. Use YYYY-MM-DD"))
 			return
 		}
 	}
 	if endDate != "" {
 		if _, err := time.Parse("2006-01-02", endDate); err != nil {
-			http.Error(w, "Invalid endDate format. Use YYYY-MM-DD", http.StatusBadRequest)
+			writeError(w, r, apperr.Validation("invalid endDate format. Use YYYY-MM-DD"))
 			return
 		}
 	}
 
-	data, err := h.service.GetNumberOfOrderedItems(startDate, endDate)
+	data, err := h.service.GetNumberOfOrderedItems(r.Context(), startDate, endDate)
 	if err != nil {
-		http.Error(w, "Failed to fetch ordered items: "+err.Error(), http.StatusInternalServerError)
+		log.Print("Failed to fetch ordered items", "error", err)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	writeJSON(w, http.StatusOK, data)
 }
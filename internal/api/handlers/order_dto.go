@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"frappuccino/models"
+	"time"
+)
+
+type OrderRequest struct {
+	CustomerName string             `json:"customer_name"`
+	Items        []OrderItemRequest `json:"items"`
+}
+
+type OrderItemRequest struct {
+	ProductID     int64                 `json:"product_id"`
+	Quantity      int                   `json:"quantity"`
+	Customization *CustomizationRequest `json:"customization,omitempty"`
+}
+
+type CustomizationRequest struct {
+	Modifiers []ModifierSelectionRequest `json:"modifiers"`
+}
+
+type OrderItemQuantityRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+type ModifierSelectionRequest struct {
+	ModifierID int64 `json:"modifier_id"`
+	Quantity   int   `json:"quantity,omitempty"`
+}
+
+type OrderResponse struct {
+	ID           int64               `json:"id"`
+	CustomerName string              `json:"customer_name"`
+	Items        []OrderItemResponse `json:"items"`
+	TotalPrice   float64             `json:"total_price"`
+	Status       string              `json:"status"`
+	Version      int64               `json:"version"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+type OrderItemResponse struct {
+	ID            int64                  `json:"id"`
+	ProductID     int64                  `json:"product_id"`
+	ProductName   string                 `json:"product_name"`
+	Quantity      int                    `json:"quantity"`
+	UnitPrice     float64                `json:"unit_price"`
+	Customization *CustomizationResponse `json:"customization,omitempty"`
+}
+
+type CustomizationResponse struct {
+	Modifiers []AppliedModifierResponse `json:"modifiers"`
+}
+
+type AppliedModifierResponse struct {
+	ModifierID int64   `json:"modifier_id"`
+	Name       string  `json:"name"`
+	Quantity   int     `json:"quantity"`
+	PriceDelta float64 `json:"price_delta"`
+}
+
+func (req OrderRequest) toModel() models.Order {
+	order := models.Order{
+		CustomerName: req.CustomerName,
+		Items:        make([]models.OrderItem, 0, len(req.Items)),
+	}
+	for _, item := range req.Items {
+		order.Items = append(order.Items, item.toModel())
+	}
+	return order
+}
+
+func (req OrderItemRequest) toModel() models.OrderItem {
+	line := models.OrderItem{
+		ProductID: req.ProductID,
+		Quantity:  req.Quantity,
+	}
+	if req.Customization != nil {
+		for _, m := range req.Customization.Modifiers {
+			line.Customization.Modifiers = append(line.Customization.Modifiers, models.AppliedModifier{
+				ModifierID: m.ModifierID,
+				Quantity:   m.Quantity,
+			})
+		}
+	}
+	return line
+}
+
+func newOrderResponse(order models.Order) OrderResponse {
+	resp := OrderResponse{
+		ID:           order.ID,
+		CustomerName: order.CustomerName,
+		Items:        make([]OrderItemResponse, 0, len(order.Items)),
+		TotalPrice:   order.TotalPrice,
+		Status:       string(order.Status),
+		Version:      order.Version,
+		CreatedAt:    order.CreatedAt,
+	}
+	for _, item := range order.Items {
+		line := OrderItemResponse{
+			ID:          item.ID,
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+		}
+		if len(item.Customization.Modifiers) > 0 {
+			line.Customization = &CustomizationResponse{}
+			for _, m := range item.Customization.Modifiers {
+				line.Customization.Modifiers = append(line.Customization.Modifiers, AppliedModifierResponse{
+					ModifierID: m.ModifierID,
+					Name:       m.Name,
+					Quantity:   m.Quantity,
+					PriceDelta: m.PriceDelta,
+				})
+			}
+		}
+		resp.Items = append(resp.Items, line)
+	}
+	return resp
+}
+
+func newOrderResponses(orders []models.Order) []OrderResponse {
+	resp := make([]OrderResponse, 0, len(orders))
+	for _, order := range orders {
+		resp = append(resp, newOrderResponse(order))
+	}
+	return resp
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"encoding/json"
+	"frappuccino/internal/apperr"
 	"frappuccino/internal/service"
 	"log"
 	"net/http"
@@ -16,39 +16,36 @@ func NewReportsHandler(svc service.ReportsService) *ReportsHandler {
 }
 
 func (h *ReportsHandler) GetTotalSales(w http.ResponseWriter, r *http.Request) {
-	totalSales, err := h.service.GetTotalSales()
+	totalSales, err := h.service.GetTotalSales(r.Context())
 	if err != nil {
 		log.Print("Failed to get total sales", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	response := struct {
-		TotalSales float64 `json:"total_sales"`
-	}{
-		TotalSales: totalSales,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-	}
+	writeJSON(w, http.StatusOK, TotalSalesResponse{TotalSales: totalSales})
 }
 
 func (h *ReportsHandler) GetPopularItems(w http.ResponseWriter, r *http.Request) {
-	popularItems, err := h.service.GetPopularItems(3) // Default to top 3
+	popularItems, err := h.service.GetPopularItems(r.Context(), 3) // Default to top 3
 	if err != nil {
 		log.Print("Failed to get popular items", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(popularItems); err != nil {
-		log.Print("Failed to encode response", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	writeJSON(w, http.StatusOK, newMenuItemResponses(popularItems))
+}
+
+func (h *ReportsHandler) GetMargins(w http.ResponseWriter, r *http.Request) {
+	margins, err := h.service.GetMargins(r.Context())
+	if err != nil {
+		log.Print("Failed to get margins", "error", err)
+		writeError(w, r, err)
+		return
 	}
+
+	writeJSON(w, http.StatusOK, newMarginResponses(margins))
 }
 
 func (h *ReportsHandler) SearchReportHandler(w http.ResponseWriter, r *http.Request) {
@@ -58,18 +55,17 @@ func (h *ReportsHandler) SearchReportHandler(w http.ResponseWriter, r *http.Requ
 	max := r.URL.Query().Get("maxPrice")
 
 	if q == "" {
-		http.Error(w, "query param 'q' is required", http.StatusBadRequest)
+		writeError(w, r, apperr.Validation("query param 'q' is required"))
 		return
 	}
 
-	resp, err := h.service.SearchReport(q, filter, min, max)
+	report, err := h.service.SearchReport(r.Context(), q, filter, min, max)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	writeJSON(w, http.StatusOK, newSearchReportResponse(report))
 }
 
 func (h *ReportsHandler) OrderedItemsByPeriodHandler(w http.ResponseWriter, r *http.Request) {
@@ -78,12 +74,11 @@ func (h *ReportsHandler) OrderedItemsByPeriodHandler(w http.ResponseWriter, r *h
 	month := query.Get("month")
 	year := query.Get("year")
 
-	resp, err := h.service.GetOrderedItemsByPeriod(period, month, year)
+	report, err := h.service.GetOrderedItemsByPeriod(r.Context(), period, month, year)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	writeJSON(w, http.StatusOK, newOrderedItemsByPeriodResponse(report))
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import "frappuccino/models"
+
+type TotalSalesResponse struct {
+	TotalSales float64 `json:"total_sales"`
+}
+
+type SearchReportResponse struct {
+	MenuItems    []MenuItemSearchResult `json:"menu_items"`
+	Orders       []OrderSearchResult    `json:"orders"`
+	TotalMatches int                    `json:"total_matches"`
+}
+
+type MenuItemSearchResult struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Relevance   float64 `json:"relevance"`
+}
+
+type OrderSearchResult struct {
+	ID           int      `json:"id"`
+	CustomerName string   `json:"customer_name"`
+	Items        []string `json:"items"`
+	Total        float64  `json:"total"`
+	Relevance    float64  `json:"relevance"`
+}
+
+type MarginResponse struct {
+	ProductID     int64   `json:"product_id"`
+	Name          string  `json:"name"`
+	Price         float64 `json:"price"`
+	Cost          float64 `json:"cost"`
+	GrossMargin   float64 `json:"gross_margin"`
+	MarginPercent float64 `json:"margin_percent"`
+}
+
+type OrderedItemsByPeriodResponse struct {
+	Period       string                     `json:"period"`
+	Month        string                     `json:"month,omitempty"`
+	Year         string                     `json:"year,omitempty"`
+	OrderedItems []OrderedItemCountResponse `json:"ordered_items"`
+}
+
+type OrderedItemCountResponse struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+func newSearchReportResponse(report models.SearchReportResponse) SearchReportResponse {
+	resp := SearchReportResponse{
+		MenuItems:    make([]MenuItemSearchResult, 0, len(report.MenuItems)),
+		Orders:       make([]OrderSearchResult, 0, len(report.Orders)),
+		TotalMatches: report.TotalMatches,
+	}
+	for _, item := range report.MenuItems {
+		resp.MenuItems = append(resp.MenuItems, MenuItemSearchResult(item))
+	}
+	for _, order := range report.Orders {
+		resp.Orders = append(resp.Orders, OrderSearchResult(order))
+	}
+	return resp
+}
+
+func newOrderedItemsByPeriodResponse(report models.OrderedItemsByPeriodResponse) OrderedItemsByPeriodResponse {
+	resp := OrderedItemsByPeriodResponse{
+		Period:       report.Period,
+		Month:        report.Month,
+		Year:         report.Year,
+		OrderedItems: make([]OrderedItemCountResponse, 0, len(report.OrderedItems)),
+	}
+	for _, item := range report.OrderedItems {
+		resp.OrderedItems = append(resp.OrderedItems, OrderedItemCountResponse(item))
+	}
+	return resp
+}
+
+func newMarginResponses(margins []models.MenuItemMargin) []MarginResponse {
+	resp := make([]MarginResponse, 0, len(margins))
+	for _, m := range margins {
+		resp = append(resp, MarginResponse(m))
+	}
+	return resp
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeouts disables the deadline of a group of routes when it is zero.
+type Timeouts struct {
+	Default time.Duration
+	Reports time.Duration
+}
+
+func withTimeout(d time.Duration, next http.HandlerFunc) http.Handler {
+	if d <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
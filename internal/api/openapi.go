@@ -0,0 +1,221 @@
+package api
+
+import (
+	"frappuccino/internal/api/handlers"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// buildSpec derives body schemas from the DTOs, so the document cannot drift
+// from what the handlers encode.
+func buildSpec(routes []route) map[string]any {
+	schemas := newSchemaSet()
+	errorSchema := schemas.of(reflect.TypeOf(handlers.ErrorResponse{}))
+
+	paths := make(map[string]map[string]any)
+	for _, rt := range routes {
+		op := map[string]any{
+			"operationId": operationID(rt.handler),
+			"summary":     rt.summary,
+			"tags":        []string{rt.tag},
+		}
+
+		var params []map[string]any
+		for _, name := range pathParams(rt.path) {
+			params = append(params, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "integer", "format": "int64"},
+			})
+		}
+		params = appendParams(params, "query", rt.query)
+		params = appendParams(params, "header", rt.headers)
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if rt.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(schemas.of(reflect.TypeOf(rt.request))),
+			}
+		}
+
+		success := map[string]any{"description": http.StatusText(rt.status)}
+		if rt.response != nil {
+			success["content"] = jsonContent(schemas.of(reflect.TypeOf(rt.response)))
+		}
+		op["responses"] = map[string]any{
+			strconv.Itoa(rt.status): success,
+			"default": map[string]any{
+				"description": "Error",
+				"content":     jsonContent(errorSchema),
+			},
+		}
+
+		if paths[rt.path] == nil {
+			paths[rt.path] = make(map[string]any)
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Frappuccino API",
+			"version": "1.0.0",
+			"description": "Bodies use snake_case field names. Query parameters from the original API " +
+				"(startDate, endDate, minPrice, maxPrice, sortBy, page, pageSize) and the page envelope of the " +
+				"offset-paginated lists (currentPage, hasNextPage, pageSize, totalPages) are camelCase.",
+		},
+		"servers":    []map[string]any{{"url": APIPrefix}},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas.components},
+	}
+}
+
+func appendParams(params []map[string]any, location string, ps []queryParam) []map[string]any {
+	for _, q := range ps {
+		schema := map[string]any{"type": q.kind}
+		if q.format != "" {
+			schema["format"] = q.format
+		}
+		params = append(params, map[string]any{
+			"name":        q.name,
+			"in":          location,
+			"required":    q.required,
+			"description": q.description,
+			"schema":      schema,
+		})
+	}
+	return params
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.Trim(segment, "{}"))
+		}
+	}
+	return names
+}
+
+func operationID(h http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	name = name[strings.LastIndex(name, ".")+1:]
+	name = strings.TrimSuffix(name, "Handler")
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+type schemaSet struct {
+	components map[string]any
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{components: make(map[string]any)}
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	decimalType     = reflect.TypeOf(decimal.Decimal{})
+	jsonDecimalType = reflect.TypeOf(handlers.JSONDecimal{})
+)
+
+func (s *schemaSet) of(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.of(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			// Siblings of $ref are ignored in OpenAPI 3.0, so wrap the reference.
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		if t == decimalType || t == jsonDecimalType {
+			return map[string]any{"type": "number"}
+		}
+		name := componentName(t)
+		if _, ok := s.components[name]; !ok {
+			// Reserve the name first so recursive types terminate.
+			s.components[name] = nil
+			s.components[name] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int32, reflect.Int16, reflect.Int8:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64, reflect.Float32:
+		return map[string]any{"type": "number"}
+	default:
+		// any, e.g. the details of an error.
+		return map[string]any{}
+	}
+}
+
+func (s *schemaSet) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	base, args, ok := strings.Cut(name, "[")
+	if !ok {
+		return name
+	}
+	args = strings.TrimSuffix(args, "]")
+	return base + args[strings.LastIndex(args, ".")+1:]
+}
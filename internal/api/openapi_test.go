@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"frappuccino/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The stubs satisfy the service interfaces; building the router never calls them.
+type (
+	stubOrderService       struct{ service.OrderService }
+	stubMenuService        struct{ service.MenuService }
+	stubInventoryService   struct{ service.InventoryService }
+	stubReportsService     struct{ service.ReportsService }
+	stubModifierService    struct{ service.ModifierService }
+	stubIdempotencyService struct{ service.IdempotencyService }
+)
+
+var wildcardRe = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+func wildcards(path string) []string {
+	var names []string
+	for _, m := range wildcardRe.FindAllStringSubmatch(path, -1) {
+		names = append(names, m[1])
+	}
+	slices.Sort(names)
+	return names
+}
+
+type specOperation struct {
+	Parameters []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+}
+
+func TestEveryRegisteredRouteIsInSpec(t *testing.T) {
+	router, patterns := newRouter(
+		stubOrderService{}, stubMenuService{}, stubInventoryService{},
+		stubReportsService{}, stubModifierService{}, stubIdempotencyService{},
+		Timeouts{Default: time.Second, Reports: time.Second},
+	)
+	if len(patterns) == 0 {
+		t.Fatal("no routes registered")
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json returned %d", rec.Code)
+	}
+	var spec struct {
+		Paths map[string]map[string]specOperation `json:"paths"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&spec); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+
+	registered := make(map[string]bool, len(patterns))
+	for _, pattern := range patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			t.Errorf("pattern %q has no method, so it is served for every method", pattern)
+			continue
+		}
+		registered[pattern] = true
+
+		op, ok := spec.Paths[path][strings.ToLower(method)]
+		if !ok {
+			t.Errorf("%s is registered but missing from the spec", pattern)
+			continue
+		}
+		var documented []string
+		for _, p := range op.Parameters {
+			if p.In == "path" {
+				documented = append(documented, p.Name)
+			}
+		}
+		slices.Sort(documented)
+		if want := wildcards(path); !slices.Equal(documented, want) {
+			t.Errorf("%s documents path parameters %v, want %v", pattern, documented, want)
+		}
+	}
+
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if pattern := strings.ToUpper(method) + " " + path; !registered[pattern] {
+				t.Errorf("%s is in the spec but not registered", pattern)
+			}
+		}
+	}
+}
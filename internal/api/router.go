@@ -1,55 +1,79 @@
 package api
 
 import (
+	"encoding/json"
 	"frappuccino/internal/api/handlers"
 	"frappuccino/internal/service"
+	"log"
 	"net/http"
 )
 
+const APIPrefix = "/api/v1"
+
 func NewRouter(
 	orderSvc service.OrderService,
 	menuSvc service.MenuService,
 	inventorySvc service.InventoryService,
 	reportsSvc service.ReportsService,
+	modifierSvc service.ModifierService,
+	idempotencySvc service.IdempotencyService,
+	timeouts Timeouts,
 ) http.Handler {
-	mux := http.NewServeMux()
+	handler, _ := newRouter(orderSvc, menuSvc, inventorySvc, reportsSvc, modifierSvc, idempotencySvc, timeouts)
+	return handler
+}
+
+func newRouter(
+	orderSvc service.OrderService,
+	menuSvc service.MenuService,
+	inventorySvc service.InventoryService,
+	reportsSvc service.ReportsService,
+	modifierSvc service.ModifierService,
+	idempotencySvc service.IdempotencyService,
+	timeouts Timeouts,
+) (http.Handler, []string) {
+	mux := &recordingMux{ServeMux: http.NewServeMux()}
 
 	// Initialize handlers
-	orderHandler := handlers.NewOrderHandler(orderSvc)
-	menuHandler := handlers.NewMenuHandler(menuSvc)
-	inventoryHandler := handlers.NewInventoryHandler(inventorySvc)
-	reportsHandler := handlers.NewReportsHandler(reportsSvc)
-
-	// Order endpoints
-	mux.HandleFunc("POST /orders", orderHandler.CreateOrder)
-	mux.HandleFunc("GET /orders", orderHandler.GetOrders)
-	mux.HandleFunc("GET /orders/{id}", orderHandler.GetOrder)
-	mux.HandleFunc("PUT /orders/{id}", orderHandler.UpdateOrder)
-	mux.HandleFunc("DELETE /orders/{id}", orderHandler.DeleteOrder)
-	mux.HandleFunc("POST /orders/{id}/close", orderHandler.CloseOrder)
-
-	// Menu endpoints
-	mux.HandleFunc("POST /menu", menuHandler.CreateMenuItem)
-	mux.HandleFunc("GET /menu", menuHandler.GetMenuItems)
-	mux.HandleFunc("GET /menu/{id}", menuHandler.GetMenuItem)
-	mux.HandleFunc("PUT /menu/{id}", menuHandler.UpdateMenuItem)
-	mux.HandleFunc("DELETE /menu/{id}", menuHandler.DeleteMenuItem)
-
-	// Inventory endpoints
-	mux.HandleFunc("POST /inventory", inventoryHandler.CreateInventoryItem)
-	mux.HandleFunc("GET /inventory", inventoryHandler.GetInventoryItems)
-	mux.HandleFunc("GET /inventory/{id}", inventoryHandler.GetInventoryItem)
-	mux.HandleFunc("PUT /inventory/{id}", inventoryHandler.UpdateInventoryItem)
-	mux.HandleFunc("DELETE /inventory/{id}", inventoryHandler.DeleteInventoryItem)
-
-	// Reports endpoints
-	mux.HandleFunc("GET /reports/total-sales", reportsHandler.GetTotalSales)
-	mux.HandleFunc("GET /reports/popular-items", reportsHandler.GetPopularItems)
-	
-	mux.HandleFunc("GET /orders/numberOfOrderedItems", orderHandler.GetNumberOfOrderedItems)
-	mux.HandleFunc("GET /reports/search", reportsHandler.SearchReportHandler)
-	mux.HandleFunc("GET /reports/orderedItemsByPeriod", reportsHandler.OrderedItemsByPeriodHandler) //not done
-	mux.HandleFunc("GET /inventory/getLeftOvers", inventoryHandler.GetLeftOversHandler)
-
-	return mux
+	rs := routes(
+		handlers.NewOrderHandler(orderSvc, idempotencySvc),
+		handlers.NewMenuHandler(menuSvc),
+		handlers.NewInventoryHandler(inventorySvc),
+		handlers.NewReportsHandler(reportsSvc),
+		handlers.NewModifierHandler(modifierSvc),
+	)
+
+	for _, rt := range rs {
+		timeout := timeouts.Default
+		if rt.report {
+			timeout = timeouts.Reports
+		}
+		mux.Handle(rt.pattern(), withTimeout(timeout, rt.handler))
+	}
+
+	spec := buildSpec(rs)
+
+	root := http.NewServeMux()
+	root.Handle(APIPrefix+"/", http.StripPrefix(APIPrefix, mux))
+	root.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(spec); err != nil {
+			log.Print("Failed to encode OpenAPI document", "error", err)
+		}
+	})
+	return root, mux.patterns
+}
+
+type recordingMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (m *recordingMux) Handle(pattern string, handler http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m *recordingMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
 }
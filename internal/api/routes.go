@@ -0,0 +1,233 @@
+package api
+
+import (
+	"frappuccino/internal/api/handlers"
+	"frappuccino/models"
+	"net/http"
+	"strings"
+)
+
+type route struct {
+	method   string
+	path     string
+	handler  http.HandlerFunc
+	report   bool
+	tag      string
+	summary  string
+	query    []queryParam
+	headers  []queryParam
+	request  any
+	status   int
+	response any
+}
+
+type queryParam struct {
+	name        string
+	kind        string // an OpenAPI primitive type
+	format      string
+	required    bool
+	description string
+}
+
+func (rt route) pattern() string {
+	return rt.method + " " + rt.path
+}
+
+var pageParams = []queryParam{
+	{name: "page", kind: "integer", description: "Page number, starting at 1"},
+	{name: "pageSize", kind: "integer", description: "Items per page, 10 by default and at most 100"},
+}
+
+func listParams(sortKeys []string, filters ...queryParam) []queryParam {
+	return append([]queryParam{
+		{name: "limit", kind: "integer", description: "Items per page, 20 by default and at most 100"},
+		{name: "cursor", kind: "string", description: "next_cursor of the previous page"},
+		{name: "sort", kind: "string", description: "One of " + strings.Join(sortKeys, ", ") + "; prefix with - to sort descending"},
+	}, filters...)
+}
+
+var (
+	ifMatchHeader = []queryParam{{name: "If-Match", kind: "string",
+		description: "ETag of the version the change is based on; 412 if it is no longer current"}}
+	requiredIfMatchHeader = []queryParam{{name: "If-Match", kind: "string", required: true,
+		description: "ETag of the version the change is based on, or * for any version; 412 if it is no longer current, 428 if missing"}}
+)
+
+func dateParam(name string) queryParam {
+	return queryParam{name: name, kind: "string", format: "date", description: "Date in YYYY-MM-DD format"}
+}
+
+func routes(
+	orderHandler *handlers.OrderHandler,
+	menuHandler *handlers.MenuHandler,
+	inventoryHandler *handlers.InventoryHandler,
+	reportsHandler *handlers.ReportsHandler,
+	modifierHandler *handlers.ModifierHandler,
+) []route {
+	return []route{
+		// Order endpoints
+		{method: "POST", path: "/orders", handler: orderHandler.CreateOrder, tag: "orders",
+			summary: "Create an order and reserve its ingredients",
+			headers: []queryParam{{name: handlers.IdempotencyKeyHeader, kind: "string",
+				description: "Makes retries safe: a repeated request with the same key returns the original response"}},
+			request: handlers.OrderRequest{}, status: http.StatusCreated, response: handlers.OrderResponse{}},
+		{method: "GET", path: "/orders", handler: orderHandler.GetOrders, tag: "orders",
+			summary: "List orders, newest first by default",
+			query: listParams(models.OrderSortKeys,
+				queryParam{name: "status", kind: "string", description: "One of " + strings.Join(models.OrderStatuses, ", ")},
+				queryParam{name: "customer", kind: "string", description: "Part of the customer name, ignoring case"},
+				queryParam{name: "from", kind: "string", description: "Earliest created_at, as YYYY-MM-DD or RFC 3339"},
+				queryParam{name: "to", kind: "string", description: "Latest created_at, as YYYY-MM-DD (inclusive) or RFC 3339 (exclusive)"}),
+			status: http.StatusOK, response: handlers.ListResponse[handlers.OrderResponse]{}},
+		{method: "GET", path: "/orders/{id}", handler: orderHandler.GetOrder, tag: "orders",
+			summary: "Get an order",
+			status:  http.StatusOK, response: handlers.OrderResponse{}},
+		{method: "PUT", path: "/orders/{id}", handler: orderHandler.UpdateOrder, tag: "orders", headers: requiredIfMatchHeader,
+			summary: "Replace the customer name and lines of an open order",
+			request: handlers.OrderRequest{}, status: http.StatusOK, response: handlers.OrderResponse{}},
+		{method: "POST", path: "/orders/{id}/items", handler: orderHandler.AddOrderItem, tag: "orders", headers: ifMatchHeader,
+			summary: "Add a line to an open order",
+			request: handlers.OrderItemRequest{}, status: http.StatusCreated, response: handlers.OrderResponse{}},
+		{method: "PATCH", path: "/orders/{id}/items/{item_id}", handler: orderHandler.UpdateOrderItem, tag: "orders", headers: requiredIfMatchHeader,
+			summary: "Change the quantity of a line of an open order",
+			request: handlers.OrderItemQuantityRequest{}, status: http.StatusOK, response: handlers.OrderResponse{}},
+		{method: "DELETE", path: "/orders/{id}/items/{item_id}", handler: orderHandler.RemoveOrderItem, tag: "orders", headers: requiredIfMatchHeader,
+			summary: "Remove a line from an open order",
+			status:  http.StatusOK, response: handlers.OrderResponse{}},
+		{method: "DELETE", path: "/orders/{id}", handler: orderHandler.DeleteOrder, tag: "orders", headers: requiredIfMatchHeader,
+			summary: "Delete an order",
+			status:  http.StatusNoContent},
+		{method: "POST", path: "/orders/{id}/start", handler: orderHandler.StartOrder, tag: "orders",
+			summary: "Start preparing a pending order",
+			status:  http.StatusOK, response: handlers.OrderResponse{}},
+		{method: "POST", path: "/orders/{id}/close", handler: orderHandler.CloseOrder, tag: "orders",
+			summary: "Close an order that is being processed",
+			status:  http.StatusOK, response: handlers.OrderResponse{}},
+		{method: "POST", path: "/orders/{id}/cancel", handler: orderHandler.CancelOrder, tag: "orders",
+			summary: "Cancel an order and return its ingredients to stock",
+			status:  http.StatusOK, response: handlers.OrderResponse{}},
+
+		// Menu endpoints
+		{method: "POST", path: "/menu", handler: menuHandler.CreateMenuItem, tag: "menu",
+			summary: "Add a menu item",
+			request: handlers.MenuItemRequest{}, status: http.StatusCreated, response: handlers.MenuItemResponse{}},
+		{method: "GET", path: "/menu", handler: menuHandler.GetMenuItems, tag: "menu",
+			summary: "List menu items with the portions available",
+			query: listParams(models.MenuSortKeys,
+				queryParam{name: "category", kind: "string", description: "Only items in this category"},
+				queryParam{name: "min_price", kind: "number"},
+				queryParam{name: "max_price", kind: "number"},
+				queryParam{name: "include_archived", kind: "boolean", description: "Also list items taken off the menu"}),
+			status: http.StatusOK, response: handlers.ListResponse[handlers.MenuItemResponse]{}},
+		{method: "GET", path: "/menu/availability", handler: menuHandler.GetAvailability, tag: "menu",
+			summary: "How many portions of every menu item can be made from current stock",
+			status:  http.StatusOK, response: []handlers.MenuAvailabilityResponse{}},
+		{method: "GET", path: "/menu/{id}", handler: menuHandler.GetMenuItem, tag: "menu",
+			summary: "Get a menu item with its applicable modifiers",
+			status:  http.StatusOK, response: handlers.MenuItemResponse{}},
+		{method: "PUT", path: "/menu/{id}", handler: menuHandler.UpdateMenuItem, tag: "menu", headers: requiredIfMatchHeader,
+			summary: "Update a menu item",
+			request: handlers.MenuItemRequest{}, status: http.StatusOK, response: handlers.MenuItemResponse{}},
+		{method: "DELETE", path: "/menu/{id}", handler: menuHandler.ArchiveMenuItem, tag: "menu", headers: requiredIfMatchHeader,
+			summary: "Take a menu item off the menu; past orders keep it",
+			status:  http.StatusNoContent},
+		{method: "POST", path: "/menu/{id}/restore", handler: menuHandler.RestoreMenuItem, tag: "menu", headers: ifMatchHeader,
+			summary: "Put an archived menu item back on the menu",
+			status:  http.StatusOK, response: handlers.MenuItemResponse{}},
+		{method: "GET", path: "/menu/{id}/price-history", handler: menuHandler.GetPriceHistory, tag: "menu",
+			summary: "List the price changes of a menu item",
+			status:  http.StatusOK, response: []handlers.PriceChangeResponse{}},
+
+		// Modifier endpoints
+		{method: "POST", path: "/modifiers", handler: modifierHandler.CreateModifier, tag: "modifiers",
+			summary: "Add a modifier to the catalog",
+			request: handlers.ModifierRequest{}, status: http.StatusCreated, response: handlers.ModifierResponse{}},
+		{method: "GET", path: "/modifiers", handler: modifierHandler.GetModifiers, tag: "modifiers",
+			summary: "List modifiers",
+			status:  http.StatusOK, response: []handlers.ModifierResponse{}},
+		{method: "GET", path: "/modifiers/{id}", handler: modifierHandler.GetModifier, tag: "modifiers",
+			summary: "Get a modifier",
+			status:  http.StatusOK, response: handlers.ModifierResponse{}},
+		{method: "PUT", path: "/modifiers/{id}", handler: modifierHandler.UpdateModifier, tag: "modifiers",
+			summary: "Update a modifier",
+			request: handlers.ModifierRequest{}, status: http.StatusOK, response: handlers.ModifierResponse{}},
+		{method: "DELETE", path: "/modifiers/{id}", handler: modifierHandler.DeleteModifier, tag: "modifiers",
+			summary: "Delete a modifier",
+			status:  http.StatusNoContent},
+
+		// Inventory endpoints
+		{method: "POST", path: "/inventory", handler: inventoryHandler.CreateInventoryItem, tag: "inventory",
+			summary: "Add an inventory item",
+			request: handlers.InventoryItemRequest{}, status: http.StatusCreated, response: handlers.InventoryItemResponse{}},
+		{method: "GET", path: "/inventory", handler: inventoryHandler.GetInventoryItems, tag: "inventory",
+			summary: "List inventory items",
+			query: listParams(models.InventorySortKeys,
+				queryParam{name: "unit", kind: "string", description: "One of " + strings.Join(models.Units, ", ")},
+				queryParam{name: "low_stock", kind: "boolean", description: "Only items at or below their reorder level"}),
+			status: http.StatusOK, response: handlers.ListResponse[handlers.InventoryItemResponse]{}},
+		{method: "GET", path: "/inventory/{id}", handler: inventoryHandler.GetInventoryItem, tag: "inventory",
+			summary: "Get an inventory item",
+			status:  http.StatusOK, response: handlers.InventoryItemResponse{}},
+		{method: "PUT", path: "/inventory/{id}", handler: inventoryHandler.UpdateInventoryItem, tag: "inventory", headers: requiredIfMatchHeader,
+			summary: "Update an inventory item",
+			request: handlers.InventoryItemRequest{}, status: http.StatusOK, response: handlers.InventoryItemResponse{}},
+		{method: "DELETE", path: "/inventory/{id}", handler: inventoryHandler.DeleteInventoryItem, tag: "inventory", headers: requiredIfMatchHeader,
+			summary: "Delete an inventory item; refused with 409 while recipes or modifiers use it, unless force or replacement_id is given",
+			query: []queryParam{
+				{name: "force", kind: "boolean", description: "Delete anyway, dropping the item from recipes and deleting substitute modifiers built on it"},
+				{name: "replacement_id", kind: "integer", description: "Rewrite recipes and modifiers to use this inventory item instead, in the same transaction"},
+			},
+			status: http.StatusNoContent},
+		{method: "POST", path: "/inventory/{id}/purchase", handler: inventoryHandler.PurchaseInventory, tag: "inventory",
+			summary: "Record a delivery; the delta must be positive",
+			request: handlers.InventoryMovementRequest{}, status: http.StatusOK, response: handlers.InventoryItemResponse{}},
+		{method: "POST", path: "/inventory/{id}/waste", handler: inventoryHandler.WasteInventory, tag: "inventory",
+			summary: "Record spilled or spoiled stock; the delta must be negative",
+			request: handlers.InventoryMovementRequest{}, status: http.StatusOK, response: handlers.InventoryItemResponse{}},
+		{method: "POST", path: "/inventory/{id}/adjust", handler: inventoryHandler.AdjustInventory, tag: "inventory",
+			summary: "Correct the stock count by a signed delta",
+			request: handlers.InventoryMovementRequest{}, status: http.StatusOK, response: handlers.InventoryItemResponse{}},
+		{method: "GET", path: "/inventory/{id}/transactions", handler: inventoryHandler.GetInventoryTransactions, tag: "inventory",
+			summary: "List the stock movements of an inventory item, newest first",
+			query:   append([]queryParam{dateParam("startDate"), dateParam("endDate")}, pageParams...),
+			status:  http.StatusOK, response: handlers.PageResponse[handlers.InventoryTransactionResponse]{}},
+
+		// Reports endpoints
+		{method: "GET", path: "/reports/total-sales", handler: reportsHandler.GetTotalSales, report: true, tag: "reports",
+			summary: "Total amount of closed orders",
+			status:  http.StatusOK, response: handlers.TotalSalesResponse{}},
+		{method: "GET", path: "/reports/popular-items", handler: reportsHandler.GetPopularItems, report: true, tag: "reports",
+			summary: "The most ordered menu items",
+			status:  http.StatusOK, response: []handlers.MenuItemResponse{}},
+		{method: "GET", path: "/reports/margins", handler: reportsHandler.GetMargins, report: true, tag: "reports",
+			summary: "Price, recipe cost and gross margin of every menu item, lowest margin first",
+			status:  http.StatusOK, response: []handlers.MarginResponse{}},
+		{method: "GET", path: "/orders/numberOfOrderedItems", handler: orderHandler.GetNumberOfOrderedItems, report: true, tag: "reports",
+			summary: "Quantity ordered per menu item in a date range",
+			query:   []queryParam{dateParam("startDate"), dateParam("endDate")},
+			status:  http.StatusOK, response: map[string]int{}},
+		{method: "GET", path: "/reports/search", handler: reportsHandler.SearchReportHandler, report: true, tag: "reports",
+			summary: "Full text search through orders and menu items",
+			query: []queryParam{
+				{name: "q", kind: "string", required: true, description: "Search query"},
+				{name: "filter", kind: "string", description: "Comma-separated list of orders, menu or all"},
+				{name: "minPrice", kind: "number", description: "Lowest price to include"},
+				{name: "maxPrice", kind: "number", description: "Highest price to include"},
+			},
+			status: http.StatusOK, response: handlers.SearchReportResponse{}},
+		{method: "GET", path: "/reports/orderedItemsByPeriod", handler: reportsHandler.OrderedItemsByPeriodHandler, report: true, tag: "reports",
+			summary: "Number of ordered items per day of a month or per month of a year",
+			query: []queryParam{
+				{name: "period", kind: "string", required: true, description: "day or month"},
+				{name: "month", kind: "string", description: "Month name, required for period=day"},
+				{name: "year", kind: "integer", description: "Year, the current one by default"},
+			},
+			status: http.StatusOK, response: handlers.OrderedItemsByPeriodResponse{}},
+		{method: "GET", path: "/inventory/getLeftOvers", handler: inventoryHandler.GetLeftOversHandler, report: true, tag: "inventory",
+			summary: "Stock report with stock value and days of cover, sorted and paginated",
+			query: append([]queryParam{{name: "sortBy", kind: "string",
+				description: "One of " + strings.Join(models.StockLevelSortKeys, ", ") + "; prefix with - to sort descending. days_of_cover by default"}},
+				pageParams...),
+			status: http.StatusOK, response: handlers.PageResponse[handlers.LeftOverResponse]{}},
+	}
+}
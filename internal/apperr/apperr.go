@@ -0,0 +1,95 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Code string
+
+const (
+	CodeNotFound             Code = "not_found"
+	CodeValidation           Code = "validation_error"
+	CodeConflict             Code = "conflict"
+	CodeInsufficientStock    Code = "insufficient_stock"
+	CodePreconditionFailed   Code = "precondition_failed"
+	CodePreconditionRequired Code = "precondition_required"
+	CodeIdempotencyMismatch  Code = "idempotency_key_reused"
+	CodeTimeout              Code = "timeout"
+	CodeInternal             Code = "internal_error"
+)
+
+type Error struct {
+	Code    Code
+	Message string
+	Details any
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any two errors with the same code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+func (e *Error) WithDetails(details any) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+var (
+	ErrNotFound           = &Error{Code: CodeNotFound, Message: "not found"}
+	ErrValidation         = &Error{Code: CodeValidation, Message: "validation failed"}
+	ErrConflict           = &Error{Code: CodeConflict, Message: "conflict"}
+	ErrInsufficientStock  = &Error{Code: CodeInsufficientStock, Message: "not enough inventory"}
+	ErrPreconditionFailed = &Error{Code: CodePreconditionFailed, Message: "precondition failed"}
+)
+
+func NotFound(format string, args ...any) *Error {
+	return &Error{Code: CodeNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func Validation(format string, args ...any) *Error {
+	return &Error{Code: CodeValidation, Message: fmt.Sprintf(format, args...)}
+}
+
+func Conflict(format string, args ...any) *Error {
+	return &Error{Code: CodeConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+func InsufficientStock(format string, args ...any) *Error {
+	return &Error{Code: CodeInsufficientStock, Message: fmt.Sprintf(format, args...)}
+}
+
+func PreconditionFailed(format string, args ...any) *Error {
+	return &Error{Code: CodePreconditionFailed, Message: fmt.Sprintf(format, args...)}
+}
+
+func PreconditionRequired(format string, args ...any) *Error {
+	return &Error{Code: CodePreconditionRequired, Message: fmt.Sprintf(format, args...)}
+}
+
+func IdempotencyMismatch(format string, args ...any) *Error {
+	return &Error{Code: CodeIdempotencyMismatch, Message: fmt.Sprintf(format, args...)}
+}
+
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Message: err.Error(), Err: err}
+}
+
+func CodeOf(err error) Code {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return CodeInternal
+}
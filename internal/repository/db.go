@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"frappuccino/internal/apperr"
 	"log"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type PostgresRepository struct {
@@ -32,3 +35,56 @@ func NewPostgresRepository(connStr string) (*PostgresRepository, error) {
 func (r *PostgresRepository) Close() error {
 	return r.db.Close()
 }
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// CheckVersion guards a write with optimistic locking: expected is the version
+// the client last read and current that of the locked row. A non-zero expected
+// must match current; 0 writes unconditionally.
+func CheckVersion(expected, current int64) error {
+	if expected != 0 && expected != current {
+		return apperr.PreconditionFailed("version %d is out of date; the current version is %d", expected, current)
+	}
+	return nil
+}
+
+// lockVersion and existingIDs take table and column names from the calling
+// repository, never from user input.
+func lockVersion(ctx context.Context, tx *sql.Tx, table, column string, id int64) (int64, error) {
+	var version int64
+	query := fmt.Sprintf(`SELECT version FROM %s WHERE %s = $1 FOR UPDATE`, table, column)
+	err := tx.QueryRowContext(ctx, query, id).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return version, err
+}
+
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+func existingIDs(ctx context.Context, db *sql.DB, table, column string, ids []int64) (map[int64]bool, error) {
+	found := make(map[int64]bool, len(ids))
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s = ANY($1)`, column, table, column)
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+	return found, rows.Err()
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"frappuccino/models"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	Get(ctx context.Context, key string, expiredBefore time.Time) (models.IdempotencyRecord, error)
+	ClaimTx(ctx context.Context, tx *sql.Tx, key, requestHash string) (bool, error)
+	CompleteTx(ctx context.Context, tx *sql.Tx, key string, statusCode int, body []byte) error
+}
+
+type idempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+func (r *idempotencyRepository) Get(ctx context.Context, key string, expiredBefore time.Time) (models.IdempotencyRecord, error) {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, expiredBefore); err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+
+	query := `
+		SELECT request_hash, COALESCE(status_code, 0), COALESCE(response_body, ''), created_at
+		FROM idempotency_keys
+		WHERE idempotency_key = $1`
+	record := models.IdempotencyRecord{Key: key}
+	var body string
+	err := r.db.QueryRowContext(ctx, query, key).Scan(&record.RequestHash, &record.StatusCode, &body, &record.CreatedAt)
+	if err == sql.ErrNoRows {
+		return models.IdempotencyRecord{}, ErrNotFound
+	}
+	if err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+	record.Body = []byte(body)
+	return record, nil
+}
+
+// ClaimTx blocks while a concurrent transaction holds the key, so exactly one claims it.
+func (r *idempotencyRepository) ClaimTx(ctx context.Context, tx *sql.Tx, key, requestHash string) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (idempotency_key, request_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (idempotency_key) DO NOTHING`
+	result, err := tx.ExecContext(ctx, query, key, requestHash)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected == 1, err
+}
+
+func (r *idempotencyRepository) CompleteTx(ctx context.Context, tx *sql.Tx, key string, statusCode int, body []byte) error {
+	query := `UPDATE idempotency_keys SET status_code = $1, response_body = $2 WHERE idempotency_key = $3`
+	result, err := tx.ExecContext(ctx, query, statusCode, string(body), key)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -1,20 +1,36 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"frappuccino/internal/apperr"
 	"frappuccino/models"
-	"time"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
+var ErrInsufficientStock = apperr.ErrInsufficientStock
+
 type InventoryRepository interface {
-	Create(item models.InventoryItem) (models.InventoryItem, error)
-	GetAll() ([]models.InventoryItem, error)
-	GetByID(id int64) (models.InventoryItem, error)
-	Update(item models.InventoryItem) (models.InventoryItem, error)
-	UpdateTx(tx *sql.Tx, item models.InventoryItem) (models.InventoryItem, error)
-	Delete(id int64) error
-	GetLeftOvers(sortBy string, offset, limit int) ([]models.InventoryItem, int, error)
+	Create(ctx context.Context, item models.InventoryItem) (models.InventoryItem, error)
+	List(ctx context.Context, filter models.InventoryFilter, page models.PageRequest) ([]models.InventoryItem, error)
+	GetByID(ctx context.Context, id int64) (models.InventoryItem, error)
+	UpdateTx(ctx context.Context, tx *sql.Tx, current, item models.InventoryItem) (models.InventoryItem, error)
+	GetDependentsTx(ctx context.Context, tx *sql.Tx, id int64) (models.IngredientDependents, error)
+	ReplaceIngredientTx(ctx context.Context, tx *sql.Tx, id, replacementID int64) error
+	ConvertUnitTx(ctx context.Context, tx *sql.Tx, id int64, from, to string) error
+	DeleteTx(ctx context.Context, tx *sql.Tx, id int64) error
+	ApplyTransaction(ctx context.Context, t models.InventoryTransaction) (models.InventoryItem, error)
+	ApplyTransactionTx(ctx context.Context, tx *sql.Tx, t models.InventoryTransaction) error
+	GetForUpdateTx(ctx context.Context, tx *sql.Tx, ids []int64) (map[int64]models.InventoryItem, error)
+	GetOrderConsumptionTx(ctx context.Context, tx *sql.Tx, orderID int64) (map[int64]decimal.Decimal, error)
+	GetTransactions(ctx context.Context, ingredientID int64, startDate, endDate string, offset, limit int) ([]models.InventoryTransaction, int, error)
+	GetStockLevels(ctx context.Context, windowDays int, sortBy string, desc bool, offset, limit int) ([]models.StockLevel, int, error)
+	ExistingIDs(ctx context.Context, ids []int64) (map[int64]bool, error)
+	GetUnits(ctx context.Context, ids []int64) (map[int64]string, error)
 }
 
 type inventoryRepository struct {
@@ -25,17 +41,69 @@ func NewInventoryRepository(db *sql.DB) InventoryRepository {
 	return &inventoryRepository{db: db}
 }
 
-func (r *inventoryRepository) Create(item models.InventoryItem) (models.InventoryItem, error) {
-	query := `INSERT INTO inventory (name, quantity, unit, created_at) VALUES ($1, $2, $3, $4) RETURNING ingredient_id`
-	createdAt := time.Now()
-	err := r.db.QueryRow(query, item.Name, item.Quantity, item.Unit, createdAt).Scan(&item.IngredientID)
-	item.CreatedAt=createdAt
+const inventoryColumns = `ingredient_id, name, quantity, unit, reorder_level, cost_per_unit, version, created_at, updated_at`
+
+func scanInventoryItem(row rowScanner) (models.InventoryItem, error) {
+	var item models.InventoryItem
+	err := row.Scan(&item.IngredientID, &item.Name, &item.Quantity, &item.Unit, &item.ReorderLevel, &item.CostPerUnit, &item.Version, &item.CreatedAt, &item.UpdatedAt)
 	return item, err
 }
 
-func (r *inventoryRepository) GetAll() ([]models.InventoryItem, error) {
-	query := `SELECT ingredient_id, name, quantity, unit, created_at, updated_at FROM inventory`
-	rows, err := r.db.Query(query)
+func (r *inventoryRepository) Create(ctx context.Context, item models.InventoryItem) (models.InventoryItem, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO inventory (name, quantity, unit, reorder_level, cost_per_unit)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ingredient_id, version, created_at, updated_at`
+	err = tx.QueryRowContext(ctx, query, item.Name, item.Quantity, item.Unit, item.ReorderLevel, item.CostPerUnit).
+		Scan(&item.IngredientID, &item.Version, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return models.InventoryItem{}, err
+	}
+
+	if !item.Quantity.IsZero() {
+		err = r.recordTransaction(ctx, tx, models.InventoryTransaction{
+			IngredientID:   item.IngredientID,
+			QuantityChange: item.Quantity,
+			Type:           models.TransactionInitialStock,
+		})
+		if err != nil {
+			return models.InventoryItem{}, err
+		}
+	}
+
+	return item, tx.Commit()
+}
+
+var inventorySortColumns = map[string]sortColumn{
+	"id":       {expr: "ingredient_id", cast: "bigint"},
+	"name":     {expr: "name", cast: "text"},
+	"quantity": {expr: "quantity", cast: "numeric"},
+}
+
+// List returns up to page.Limit+1 items; the extra one signals a next page.
+func (r *inventoryRepository) List(ctx context.Context, filter models.InventoryFilter, page models.PageRequest) ([]models.InventoryItem, error) {
+	col, err := sortColumnFor(inventorySortColumns, page.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var q listQuery
+	if filter.Unit != "" {
+		q.where("unit = " + q.arg(filter.Unit))
+	}
+	if filter.LowStock {
+		q.where("quantity <= reorder_level")
+	}
+	orderBy := q.paginate(col, "ingredient_id", page)
+
+	query := `SELECT ` + inventoryColumns + ` FROM inventory ` + q.whereClause() + ` ` + orderBy
+	rows, err := r.db.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -43,95 +111,497 @@ func (r *inventoryRepository) GetAll() ([]models.InventoryItem, error) {
 
 	var items []models.InventoryItem
 	for rows.Next() {
-		var item models.InventoryItem
-		if err := rows.Scan(&item.IngredientID, &item.Name, &item.Quantity, &item.Unit, &item.CreatedAt, &item.UpdatedAt); err != nil {
+		item, err := scanInventoryItem(rows)
+		if err != nil {
 			return nil, err
 		}
 		items = append(items, item)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
-func (r *inventoryRepository) GetByID(id int64) (models.InventoryItem, error) {
-	query := `SELECT ingredient_id, name, quantity, unit, created_at, updated_at FROM inventory WHERE ingredient_id = $1`
-	var item models.InventoryItem
-	err := r.db.QueryRow(query, id).Scan(&item.IngredientID, &item.Name, &item.Quantity, &item.Unit,  &item.CreatedAt, &item.UpdatedAt)
+func (r *inventoryRepository) GetByID(ctx context.Context, id int64) (models.InventoryItem, error) {
+	query := `SELECT ` + inventoryColumns + ` FROM inventory WHERE ingredient_id = $1`
+	item, err := scanInventoryItem(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return models.InventoryItem{}, ErrNotFound
 	}
 	return item, err
 }
 
-func (r *inventoryRepository) Update(item models.InventoryItem) (models.InventoryItem, error) {
-	query := `UPDATE inventory SET name = $1, quantity = $2, unit = $3, updated_at = $5 WHERE ingredient_id = $4`
-	updated_at:=time.Now()
-	result, err := r.db.Exec(query, item.Name, item.Quantity, item.Unit, item.IngredientID, updated_at)
-	item.UpdatedAt=updated_at
+// UpdateTx records a change of quantity in the ledger as an adjustment.
+func (r *inventoryRepository) UpdateTx(ctx context.Context, tx *sql.Tx, current, item models.InventoryItem) (models.InventoryItem, error) {
+	query := `
+		UPDATE inventory SET name = $1, quantity = $2, unit = $3, reorder_level = $4, cost_per_unit = $5,
+			version = version + 1, updated_at = NOW()
+		WHERE ingredient_id = $6
+		RETURNING ` + inventoryColumns
+	updated, err := scanInventoryItem(tx.QueryRowContext(ctx, query,
+		item.Name, item.Quantity, item.Unit, item.ReorderLevel, item.CostPerUnit, item.IngredientID))
 	if err != nil {
 		return models.InventoryItem{}, err
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return models.InventoryItem{}, ErrNotFound
+
+	if delta := item.Quantity.Sub(current.Quantity); !delta.IsZero() {
+		err = r.recordTransaction(ctx, tx, models.InventoryTransaction{
+			IngredientID:   item.IngredientID,
+			QuantityChange: delta,
+			Type:           models.TransactionAdjustment,
+			Reason:         "manual edit",
+		})
+		if err != nil {
+			return models.InventoryItem{}, err
+		}
+	}
+
+	return updated, nil
+}
+
+func (r *inventoryRepository) GetDependentsTx(ctx context.Context, tx *sql.Tx, id int64) (models.IngredientDependents, error) {
+	var dependents models.IngredientDependents
+	var err error
+
+	dependents.MenuItems, err = queryDependents(ctx, tx, `
+		SELECT m.product_id, m.product_name
+		FROM menu_item_ingredients mii
+		JOIN menu_items m ON m.product_id = mii.product_id
+		WHERE mii.ingredient_id = $1
+		ORDER BY m.product_id`, id)
+	if err != nil {
+		return models.IngredientDependents{}, err
+	}
+
+	dependents.Modifiers, err = queryDependents(ctx, tx, `
+		SELECT modifier_id, name
+		FROM modifiers
+		WHERE replaces_ingredient_id = $1
+		   OR substitute_ingredient_id = $1
+		   OR modifier_id IN (SELECT modifier_id FROM modifier_ingredients WHERE ingredient_id = $1)
+		ORDER BY modifier_id`, id)
+	if err != nil {
+		return models.IngredientDependents{}, err
+	}
+	return dependents, nil
+}
+
+func queryDependents(ctx context.Context, q queryer, query string, args ...any) ([]models.IngredientDependent, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
-	return item, nil
+	defer rows.Close()
+
+	dependents := []models.IngredientDependent{}
+	for rows.Next() {
+		var d models.IngredientDependent
+		if err := rows.Scan(&d.ID, &d.Name); err != nil {
+			return nil, err
+		}
+		dependents = append(dependents, d)
+	}
+	return dependents, rows.Err()
 }
 
-func (r *inventoryRepository) Delete(id int64) error {
-	query := `DELETE FROM inventory WHERE ingredient_id = $1`
-	result, err := r.db.Exec(query, id)
+// ReplaceIngredientTx converts modifier quantities to the replacement's unit;
+// recipe lines keep the unit they were measured in.
+func (r *inventoryRepository) ReplaceIngredientTx(ctx context.Context, tx *sql.Tx, id, replacementID int64) error {
+	clashes, err := queryDependents(ctx, tx, `
+		SELECT m.product_id, m.product_name
+		FROM menu_item_ingredients old
+		JOIN menu_item_ingredients repl ON repl.product_id = old.product_id AND repl.ingredient_id = $2
+		JOIN menu_items m ON m.product_id = old.product_id
+		WHERE old.ingredient_id = $1
+		UNION ALL
+		SELECT mo.modifier_id, mo.name
+		FROM modifier_ingredients old
+		JOIN modifier_ingredients repl ON repl.modifier_id = old.modifier_id AND repl.ingredient_id = $2
+		JOIN modifiers mo ON mo.modifier_id = old.modifier_id
+		WHERE old.ingredient_id = $1
+		UNION ALL
+		SELECT modifier_id, name
+		FROM modifiers
+		WHERE (replaces_ingredient_id = $1 AND substitute_ingredient_id = $2)
+		   OR (replaces_ingredient_id = $2 AND substitute_ingredient_id = $1)`, id, replacementID)
 	if err != nil {
 		return err
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return ErrNotFound
+	if len(clashes) > 0 {
+		return apperr.Conflict("ingredient '%d' is already used alongside ingredient '%d' by: %s; edit those recipes first",
+			replacementID, id, dependentNames(clashes))
+	}
+
+	const factor = `unit_factor(old.unit) / unit_factor(repl.unit)`
+	inexact, err := queryDependents(ctx, tx, `
+		SELECT m.modifier_id, m.name
+		FROM modifier_ingredients mi
+		JOIN modifiers m ON m.modifier_id = mi.modifier_id
+		JOIN inventory old ON old.ingredient_id = $1
+		JOIN inventory repl ON repl.ingredient_id = $2
+		WHERE mi.ingredient_id = $1
+		  AND mi.quantity * `+factor+` <> ROUND(mi.quantity * `+factor+`, 3)
+		ORDER BY m.modifier_id`, id, replacementID)
+	if err != nil {
+		return err
+	}
+	if len(inexact) > 0 {
+		return apperr.Conflict("the quantities of ingredient '%d' in %s cannot be expressed in the unit of ingredient '%d' with 3 decimal places",
+			id, dependentNames(inexact), replacementID)
+	}
+
+	queries := []string{`
+		UPDATE menu_item_ingredients mii
+		SET ingredient_id = $2, unit = COALESCE(mii.unit, i.unit)
+		FROM inventory i
+		WHERE i.ingredient_id = $1 AND mii.ingredient_id = $1`, `
+		UPDATE modifier_ingredients mi
+		SET ingredient_id = $2,
+		    quantity = ROUND(mi.quantity * unit_factor(old.unit) / unit_factor(repl.unit), 3)
+		FROM inventory old, inventory repl
+		WHERE old.ingredient_id = $1 AND repl.ingredient_id = $2 AND mi.ingredient_id = $1`, `
+		UPDATE modifiers SET replaces_ingredient_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE replaces_ingredient_id = $1`, `
+		UPDATE modifiers SET substitute_ingredient_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE substitute_ingredient_id = $1`, `
+		UPDATE order_items oi
+		SET consumption = (
+			SELECT jsonb_agg(jsonb_build_object('ingredient_id', u.id, 'quantity', u.quantity, 'unit', u.unit) ORDER BY u.id)
+			FROM (
+				SELECT CASE WHEN (e->>'ingredient_id')::bigint = $1 THEN $2 ELSE (e->>'ingredient_id')::bigint END AS id,
+				       SUM((e->>'quantity')::numeric) AS quantity, e->>'unit' AS unit
+				FROM jsonb_array_elements(oi.consumption) e
+				GROUP BY 1, 3
+			) u)
+		FROM orders o
+		WHERE o.order_id = oi.order_id AND o.status IN ('pending', 'processing')
+		  AND oi.consumption @> jsonb_build_array(jsonb_build_object('ingredient_id', $1::bigint))`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, id, replacementID); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (r *inventoryRepository) UpdateTx(tx *sql.Tx, item models.InventoryItem) (models.InventoryItem, error) {
-	query := "UPDATE inventory SET quantity = $1, unit = $2, updated_at = CURRENT_TIMESTAMP WHERE ingredient_id = $3"
-	_, err := tx.Exec(query, item.Quantity, item.Unit, item.IngredientID)
+// ConvertUnitTx converts modifier quantities when an item's unit changes to a
+// compatible one. The ledger keeps the unit each row was recorded in.
+func (r *inventoryRepository) ConvertUnitTx(ctx context.Context, tx *sql.Tx, id int64, from, to string) error {
+	const factor = `unit_factor($2::inventory_unit) / unit_factor($3::inventory_unit)`
+	inexact, err := queryDependents(ctx, tx, `
+		SELECT m.modifier_id, m.name
+		FROM modifier_ingredients mi
+		JOIN modifiers m ON m.modifier_id = mi.modifier_id
+		WHERE mi.ingredient_id = $1
+		  AND mi.quantity * `+factor+` <> ROUND(mi.quantity * `+factor+`, 3)
+		ORDER BY m.modifier_id`, id, from, to)
+	if err != nil {
+		return err
+	}
+	if len(inexact) > 0 {
+		return apperr.Conflict("the quantities of ingredient '%d' in %s cannot be expressed in %s with 3 decimal places",
+			id, dependentNames(inexact), to)
+	}
+
+	// The ledger keeps the unit of each row, but what open orders hold is
+	// returned in the new unit when they shrink or are cancelled.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT t.order_id
+		FROM inventory_transactions t
+		JOIN orders o ON o.order_id = t.order_id
+		WHERE t.inventory_id = $1 AND o.status IN ('pending', 'processing')
+		  AND t.transaction_type IN ('order_consumption', 'order_return')
+		GROUP BY t.order_id
+		HAVING SUM(t.quantity_change * unit_factor(t.unit)) / unit_factor($2::inventory_unit)
+		    <> ROUND(SUM(t.quantity_change * unit_factor(t.unit)) / unit_factor($2::inventory_unit), 3)
+		ORDER BY t.order_id`, id, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var orderIDs []string
+	for rows.Next() {
+		var orderID int64
+		if err := rows.Scan(&orderID); err != nil {
+			return err
+		}
+		orderIDs = append(orderIDs, fmt.Sprintf("'%d'", orderID))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(orderIDs) > 0 {
+		return apperr.Conflict("open orders %s hold amounts of ingredient '%d' that cannot be expressed in %s with 3 decimal places",
+			strings.Join(orderIDs, ", "), id, to)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE menu_item_ingredients SET unit = $2::inventory_unit
+		WHERE ingredient_id = $1 AND unit IS NULL`, id, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE modifier_ingredients SET quantity = ROUND(quantity * `+factor+`, 3)
+		WHERE ingredient_id = $1`, id, from, to)
+	return err
+}
+
+func dependentNames(dependents []models.IngredientDependent) string {
+	names := make([]string, len(dependents))
+	for i, d := range dependents {
+		names[i] = d.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (r *inventoryRepository) DeleteTx(ctx context.Context, tx *sql.Tx, id int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM inventory WHERE ingredient_id = $1`, id)
+	return err
+}
+
+func (r *inventoryRepository) ApplyTransaction(ctx context.Context, t models.InventoryTransaction) (models.InventoryItem, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return models.InventoryItem{}, err
 	}
-	return item, nil
+	defer tx.Rollback()
+
+	if err := r.ApplyTransactionTx(ctx, tx, t); err != nil {
+		return models.InventoryItem{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.InventoryItem{}, err
+	}
+	return r.GetByID(ctx, t.IngredientID)
 }
 
-func (r *inventoryRepository) GetLeftOvers(sortBy string, offset, limit int) ([]models.InventoryItem, int, error) {
-	validSortFields := map[string]string{
-		"price":    "price",
-		"quantity": "quantity",
+// ApplyTransactionTx never lets stock go negative. A unit cost is folded into
+// the cost per unit as a weighted average.
+func (r *inventoryRepository) ApplyTransactionTx(ctx context.Context, tx *sql.Tx, t models.InventoryTransaction) error {
+	query := `
+		UPDATE inventory SET
+			quantity = quantity + $1,
+			cost_per_unit = CASE
+				WHEN $3::numeric IS NULL OR quantity + $1 <= 0 THEN cost_per_unit
+				ELSE ROUND((quantity * cost_per_unit + $1 * $3::numeric) / (quantity + $1), 4)
+			END,
+			version = version + 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE ingredient_id = $2 AND quantity + $1 >= 0`
+	result, err := tx.ExecContext(ctx, query, t.QuantityChange, t.IngredientID, t.UnitCost)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM inventory WHERE ingredient_id = $1)`, t.IngredientID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return ErrInsufficientStock
 	}
 
-	sortField, ok := validSortFields[sortBy]
-	if !ok {
-		sortField = "ingredient_id" // default sort
+	return r.recordTransaction(ctx, tx, t)
+}
+
+func (r *inventoryRepository) recordTransaction(ctx context.Context, tx *sql.Tx, t models.InventoryTransaction) error {
+	query := `
+		INSERT INTO inventory_transactions (inventory_id, quantity_change, unit, transaction_type, reason, order_id, unit_cost)
+		VALUES ($1, $2, (SELECT unit FROM inventory WHERE ingredient_id = $1), $3, $4, $5, $6)`
+	_, err := tx.ExecContext(ctx, query, t.IngredientID, t.QuantityChange, t.Type, t.Reason, nullID(t.OrderID), t.UnitCost)
+	return err
+}
+
+// GetForUpdateTx locks rows in ID order so concurrent callers cannot deadlock.
+func (r *inventoryRepository) GetForUpdateTx(ctx context.Context, tx *sql.Tx, ids []int64) (map[int64]models.InventoryItem, error) {
+	query := `
+		SELECT ` + inventoryColumns + `
+		FROM inventory
+		WHERE ingredient_id = ANY($1)
+		ORDER BY ingredient_id
+		FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[int64]models.InventoryItem, len(ids))
+	for rows.Next() {
+		item, err := scanInventoryItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items[item.IngredientID] = item
+	}
+	return items, rows.Err()
+}
+
+func (r *inventoryRepository) ExistingIDs(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	return existingIDs(ctx, r.db, "inventory", "ingredient_id", ids)
+}
+
+func (r *inventoryRepository) GetUnits(ctx context.Context, ids []int64) (map[int64]string, error) {
+	units := make(map[int64]string, len(ids))
+	if len(ids) == 0 {
+		return units, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT ingredient_id, unit FROM inventory WHERE ingredient_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var unit string
+		if err := rows.Scan(&id, &unit); err != nil {
+			return nil, err
+		}
+		units[id] = unit
+	}
+	return units, rows.Err()
+}
+
+// GetOrderConsumptionTx returns what an order consumed minus what it returned.
+func (r *inventoryRepository) GetOrderConsumptionTx(ctx context.Context, tx *sql.Tx, orderID int64) (map[int64]decimal.Decimal, error) {
+	query := `
+		SELECT t.inventory_id, -SUM(t.quantity_change * unit_factor(t.unit)) / unit_factor(i.unit)
+		FROM inventory_transactions t
+		JOIN inventory i ON i.ingredient_id = t.inventory_id
+		WHERE t.order_id = $1
+		  AND t.transaction_type IN ('order_consumption', 'order_return')
+		GROUP BY t.inventory_id, i.unit
+		HAVING SUM(t.quantity_change * unit_factor(t.unit)) < 0`
+	rows, err := tx.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[int64]decimal.Decimal)
+	for rows.Next() {
+		var ingredientID int64
+		var quantity decimal.Decimal
+		if err := rows.Scan(&ingredientID, &quantity); err != nil {
+			return nil, err
+		}
+		usage[ingredientID] = quantity
 	}
+	return usage, rows.Err()
+}
+
+func (r *inventoryRepository) GetTransactions(ctx context.Context, ingredientID int64, startDate, endDate string, offset, limit int) ([]models.InventoryTransaction, int, error) {
+	filter := `
+		WHERE inventory_id = $1
+		AND ($2 = '' OR transaction_date >= $2::date)
+		AND ($3 = '' OR transaction_date < $3::date + INTERVAL '1 day')`
 
-	query := fmt.Sprintf(`SELECT ingredient_id, name, quantity, unit FROM inventory ORDER BY %s DESC LIMIT ? OFFSET ?`, sortField)
-	rows, err := r.db.Query(query, limit, offset)
+	query := `
+		SELECT id, inventory_id, quantity_change, unit, transaction_type, COALESCE(reason, ''), COALESCE(order_id, 0), unit_cost, transaction_date
+		FROM inventory_transactions` + filter + `
+		ORDER BY transaction_date DESC, id DESC
+		LIMIT $4 OFFSET $5`
+	rows, err := r.db.QueryContext(ctx, query, ingredientID, startDate, endDate, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var items []models.InventoryItem
+	var transactions []models.InventoryTransaction
 	for rows.Next() {
-		var item models.InventoryItem
-		if err := rows.Scan(&item.IngredientID, &item.Name, &item.Quantity, &item.Unit); err != nil {
+		var t models.InventoryTransaction
+		var unitCost sql.NullFloat64
+		if err := rows.Scan(&t.ID, &t.IngredientID, &t.QuantityChange, &t.Unit, &t.Type, &t.Reason, &t.OrderID, &unitCost, &t.CreatedAt); err != nil {
 			return nil, 0, err
 		}
-		items = append(items, item)
+		if unitCost.Valid {
+			t.UnitCost = &unitCost.Float64
+		}
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
 	}
 
-	// Подсчёт общего количества для пагинации
 	var total int
-	err = r.db.QueryRow(`SELECT COUNT(*) FROM inventory`).Scan(&total)
+	err = r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM inventory_transactions`+filter, ingredientID, startDate, endDate).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	return items, total, nil
+	return transactions, total, nil
+}
+
+var stockLevelSortColumns = map[string]string{
+	"quantity":      "quantity",
+	"value":         "value",
+	"days_of_cover": "days_of_cover",
+}
+
+// GetStockLevels sorts items nothing was consumed of, having no days of cover, last.
+func (r *inventoryRepository) GetStockLevels(ctx context.Context, windowDays int, sortBy string, desc bool, offset, limit int) ([]models.StockLevel, int, error) {
+	col, ok := stockLevelSortColumns[sortBy]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported sort key %q", sortBy)
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+
+	query := fmt.Sprintf(`
+		WITH consumption AS (
+			SELECT t.inventory_id, -SUM(t.quantity_change * unit_factor(t.unit)) / unit_factor(i.unit) / $1::int AS daily
+			FROM inventory_transactions t
+			JOIN inventory i ON i.ingredient_id = t.inventory_id
+			WHERE t.transaction_type IN ('order_consumption', 'order_return')
+			  AND t.transaction_date >= NOW() - make_interval(days => $1::int)
+			GROUP BY t.inventory_id, i.unit
+		), report AS (
+			SELECT i.ingredient_id, i.name, i.quantity, i.unit, i.cost_per_unit,
+			       ROUND(i.quantity * i.cost_per_unit, 2) AS value,
+			       ROUND(COALESCE(c.daily, 0), 2) AS daily,
+			       CASE WHEN c.daily > 0 THEN ROUND(i.quantity / c.daily, 1) END AS days_of_cover
+			FROM inventory i
+			LEFT JOIN consumption c ON c.inventory_id = i.ingredient_id
+		)
+		SELECT ingredient_id, name, quantity, unit, cost_per_unit, value, daily, days_of_cover
+		FROM report
+		ORDER BY %s %s NULLS LAST, ingredient_id
+		LIMIT $2 OFFSET $3`, col, dir)
+	rows, err := r.db.QueryContext(ctx, query, windowDays, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var levels []models.StockLevel
+	for rows.Next() {
+		var level models.StockLevel
+		var daysOfCover sql.NullFloat64
+		err := rows.Scan(&level.IngredientID, &level.Name, &level.Quantity, &level.Unit,
+			&level.CostPerUnit, &level.Value, &level.DailyConsumption, &daysOfCover)
+		if err != nil {
+			return nil, 0, err
+		}
+		if daysOfCover.Valid {
+			level.DaysOfCover = &daysOfCover.Float64
+		}
+		levels = append(levels, level)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM inventory`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	return levels, total, nil
 }
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"fmt"
+	"frappuccino/models"
+	"strings"
+)
+
+type sortColumn struct {
+	expr string
+	cast string
+}
+
+type listQuery struct {
+	conditions []string
+	args       []any
+}
+
+func (q *listQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *listQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// paginate fetches one row more than the page size to tell whether there is a next page.
+func (q *listQuery) paginate(col sortColumn, idColumn string, page models.PageRequest) string {
+	dir, op := "ASC", ">"
+	if page.Desc {
+		dir, op = "DESC", "<"
+	}
+	if page.After != nil {
+		q.where(fmt.Sprintf("(%s, %s) %s (%s::%s, %s)",
+			col.expr, idColumn, op, q.arg(page.After.Value), col.cast, q.arg(page.After.ID)))
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT %s", col.expr, dir, idColumn, dir, q.arg(page.Limit+1))
+}
+
+func (q *listQuery) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+func sortColumnFor(columns map[string]sortColumn, key string) (sortColumn, error) {
+	col, ok := columns[key]
+	if !ok {
+		return sortColumn{}, fmt.Errorf("unsupported sort key %q", key)
+	}
+	return col, nil
+}
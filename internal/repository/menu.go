@@ -1,22 +1,27 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"frappuccino/internal/apperr"
 	"frappuccino/models"
+	"math"
 
 	"github.com/lib/pq"
 )
 
-var ErrDuplicateID = errors.New("duplicate ID")
-
 type MenuRepository interface {
-	Create(item models.MenuItem) (models.MenuItem, error)
-	GetAll() ([]models.MenuItem, error)
-	GetByID(id int64) (models.MenuItem, error)
-	Update(id int64, item models.MenuItem) (models.MenuItem, error)
-	Delete(id int64) error
+	Create(ctx context.Context, item models.MenuItem) (models.MenuItem, error)
+	GetAll(ctx context.Context) ([]models.MenuItem, error)
+	List(ctx context.Context, filter models.MenuFilter, page models.PageRequest) ([]models.MenuItem, error)
+	GetByID(ctx context.Context, id int64) (models.MenuItem, error)
+	Update(ctx context.Context, id int64, item models.MenuItem) (models.MenuItem, error)
+	Archive(ctx context.Context, id, version int64) error
+	Restore(ctx context.Context, id, version int64) error
+	GetPriceHistory(ctx context.Context, id int64) ([]models.PriceChange, error)
+	GetAvailability(ctx context.Context) ([]models.MenuItemAvailability, error)
+	ExistingIDs(ctx context.Context, ids []int64) (map[int64]bool, error)
 }
 
 type menuRepository struct {
@@ -27,49 +32,94 @@ func NewMenuRepository(db *sql.DB) MenuRepository {
 	return &menuRepository{db: db}
 }
 
-func (r *menuRepository) Create(item models.MenuItem) (models.MenuItem, error) {
-	tx, err := r.db.Begin()
+func (r *menuRepository) Create(ctx context.Context, item models.MenuItem) (models.MenuItem, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return item, err
 	}
-
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
-		}
-	}()
+	defer tx.Rollback()
 
 	var existingProductID int64
-	checkQuery := `SELECT product_id FROM menu_items WHERE product_name = $1`
-	err = tx.QueryRow(checkQuery, item.Name).Scan(&existingProductID)
-
-	if err == nil {
-		return item, fmt.Errorf("menu item with name '%s' already exists", item.Name)
+	var archived bool
+	checkQuery := `SELECT product_id, archived_at IS NOT NULL FROM menu_items WHERE product_name = $1`
+	err = tx.QueryRowContext(ctx, checkQuery, item.Name).Scan(&existingProductID, &archived)
+	switch {
+	case err == nil && archived:
+		return item, apperr.Conflict("menu item with name '%s' is archived; restore item '%d' instead", item.Name, existingProductID)
+	case err == nil:
+		return item, apperr.Conflict("menu item with name '%s' already exists", item.Name)
+	case err != sql.ErrNoRows:
+		return item, err
 	}
 
 	query := `INSERT INTO menu_items (product_name, description, categories, price) 
-	          VALUES ($1, $2, $3, $4) RETURNING product_id`
-	err = tx.QueryRow(query, item.Name, item.Description, pq.Array(item.Categories), item.Price).Scan(&item.ID)
+	          VALUES ($1, $2, $3, $4) RETURNING product_id, version`
+	err = tx.QueryRowContext(ctx, query, item.Name, item.Description, pq.Array(item.Categories), item.Price).Scan(&item.ID, &item.Version)
 	if err != nil {
 		return item, fmt.Errorf("failed to insert menu item: %w", err)
 	}
 
 	for _, ing := range item.Ingredients {
-		ingQuery := `INSERT INTO menu_item_ingredients (ingredient_id, product_id, quantity) VALUES ($1, $2, $3)`
-		_, err = tx.Exec(ingQuery, ing.IngredientID, item.ID, ing.Quantity)
+		ingQuery := `INSERT INTO menu_item_ingredients (ingredient_id, product_id, quantity, unit) VALUES ($1, $2, $3, NULLIF($4, '')::inventory_unit)`
+		_, err = tx.ExecContext(ctx, ingQuery, ing.IngredientID, item.ID, ing.Quantity, ing.Unit)
 		if err != nil {
 			return item, fmt.Errorf("failed to insert ingredient for product_id %d: %w", item.ID, err)
 		}
 	}
 
-	return item, nil
+	return item, tx.Commit()
+}
+
+const menuColumns = `product_id, product_name, description, categories, price, version, archived_at`
+
+func scanMenuItem(row rowScanner) (models.MenuItem, error) {
+	var item models.MenuItem
+	var archivedAt sql.NullTime
+	err := row.Scan(&item.ID, &item.Name, &item.Description, pq.Array(&item.Categories), &item.Price, &item.Version, &archivedAt)
+	if archivedAt.Valid {
+		item.ArchivedAt = &archivedAt.Time
+	}
+	return item, err
+}
+
+var menuSortColumns = map[string]sortColumn{
+	"id":    {expr: "product_id", cast: "bigint"},
+	"name":  {expr: "product_name", cast: "text"},
+	"price": {expr: "price", cast: "numeric"},
+}
+
+func (r *menuRepository) GetAll(ctx context.Context) ([]models.MenuItem, error) {
+	query := `SELECT ` + menuColumns + ` FROM menu_items`
+	return r.queryMenuItems(ctx, query)
+}
+
+func (r *menuRepository) List(ctx context.Context, filter models.MenuFilter, page models.PageRequest) ([]models.MenuItem, error) {
+	col, err := sortColumnFor(menuSortColumns, page.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var q listQuery
+	if !filter.IncludeArchived {
+		q.where("archived_at IS NULL")
+	}
+	if filter.Category != "" {
+		q.where(q.arg(filter.Category) + " = ANY(categories)")
+	}
+	if filter.MinPrice != nil {
+		q.where("price >= " + q.arg(*filter.MinPrice))
+	}
+	if filter.MaxPrice != nil {
+		q.where("price <= " + q.arg(*filter.MaxPrice))
+	}
+	orderBy := q.paginate(col, "product_id", page)
+
+	query := `SELECT ` + menuColumns + ` FROM menu_items ` + q.whereClause() + ` ` + orderBy
+	return r.queryMenuItems(ctx, query, q.args...)
 }
 
-func (r *menuRepository) GetAll() ([]models.MenuItem, error) {
-	query := `SELECT product_id, product_name, description, categories, price FROM menu_items`
-	rows, err := r.db.Query(query)
+func (r *menuRepository) queryMenuItems(ctx context.Context, query string, args ...any) ([]models.MenuItem, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -77,43 +127,34 @@ func (r *menuRepository) GetAll() ([]models.MenuItem, error) {
 
 	var items []models.MenuItem
 	for rows.Next() {
-		var item models.MenuItem
-		if err := rows.Scan(&item.ID, &item.Name, &item.Description, pq.Array(&item.Categories), &item.Price); err != nil {
-			return nil, err
-		}
-
-		ingQuery := `SELECT i.ingredient_id, i.name, mi.quantity
-		             FROM menu_item_ingredients mi
-		             JOIN inventory i ON i.ingredient_id = mi.ingredient_id
-		             WHERE mi.product_id = $1`
-
-		ingRows, err := r.db.Query(ingQuery, item.ID)
+		item, err := scanMenuItem(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		var ingredients []models.MenuItemIngredient
-		for ingRows.Next() {
-			var ing models.MenuItemIngredient
-			if err := ingRows.Scan(&ing.IngredientID, &ing.ProductName, &ing.Quantity); err != nil {
-				ingRows.Close()
-				return nil, err
-			}
-			ingredients = append(ingredients, ing)
-		}
-		ingRows.Close()
-
-		item.Ingredients = ingredients
 		items = append(items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	ids := make([]int64, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	ingredients, err := r.getIngredients(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Ingredients = ingredients[items[i].ID]
+	}
 	return items, nil
 }
 
-func (r *menuRepository) GetByID(id int64) (models.MenuItem, error) {
-	query := `SELECT product_id, product_name, description, categories, price FROM menu_items WHERE product_id = $1`
-	var item models.MenuItem
-	err := r.db.QueryRow(query, id).Scan(&item.ID, &item.Name, &item.Description, pq.Array(&item.Categories), &item.Price)
+// GetByID includes archived items, so past orders can still be resolved.
+func (r *menuRepository) GetByID(ctx context.Context, id int64) (models.MenuItem, error) {
+	query := `SELECT ` + menuColumns + ` FROM menu_items WHERE product_id = $1`
+	item, err := scanMenuItem(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return models.MenuItem{}, ErrNotFound
 	}
@@ -121,78 +162,192 @@ func (r *menuRepository) GetByID(id int64) (models.MenuItem, error) {
 		return models.MenuItem{}, err
 	}
 
-	ingQuery := `SELECT i.ingredient_id, i.name, mi.quantity
-				 FROM menu_item_ingredients mi
-				 JOIN inventory i ON i.ingredient_id = mi.ingredient_id
-				 WHERE mi.product_id = $1`
-
-	rows, err := r.db.Query(ingQuery, item.ID)
+	ingredients, err := r.getIngredients(ctx, item.ID)
 	if err != nil {
 		return item, err
 	}
+	item.Ingredients = ingredients[item.ID]
+
+	return item, nil
+}
+
+func (r *menuRepository) getIngredients(ctx context.Context, productIDs ...int64) (map[int64][]models.MenuItemIngredient, error) {
+	ingredients := make(map[int64][]models.MenuItemIngredient, len(productIDs))
+	if len(productIDs) == 0 {
+		return ingredients, nil
+	}
+
+	query := `SELECT mi.product_id, i.ingredient_id, i.name, mi.quantity, COALESCE(mi.unit, i.unit), i.unit, i.cost_per_unit
+	          FROM menu_item_ingredients mi
+	          JOIN inventory i ON i.ingredient_id = mi.ingredient_id
+	          WHERE mi.product_id = ANY($1)
+	          ORDER BY i.ingredient_id`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	for rows.Next() {
+		var productID int64
 		var ing models.MenuItemIngredient
-		if err := rows.Scan(&ing.IngredientID, &ing.ProductName, &ing.Quantity); err != nil {
-			return item, err
+		if err := rows.Scan(&productID, &ing.IngredientID, &ing.ProductName, &ing.Quantity, &ing.Unit, &ing.StockUnit, &ing.CostPerUnit); err != nil {
+			return nil, err
 		}
-		item.Ingredients = append(item.Ingredients, ing)
+		ingredients[productID] = append(ingredients[productID], ing)
 	}
-
-	return item, nil
+	return ingredients, rows.Err()
 }
 
-func (r *menuRepository) Update(id int64, item models.MenuItem) (models.MenuItem, error) {
-	tx, err := r.db.Begin()
+func (r *menuRepository) Update(ctx context.Context, id int64, item models.MenuItem) (models.MenuItem, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return models.MenuItem{}, err
 	}
+	defer tx.Rollback()
 
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
-		}
-	}()
+	var oldPrice float64
+	var version int64
+	err = tx.QueryRowContext(ctx, `SELECT price, version FROM menu_items WHERE product_id = $1 FOR UPDATE`, id).Scan(&oldPrice, &version)
+	if err == sql.ErrNoRows {
+		return models.MenuItem{}, ErrNotFound
+	}
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+	if err = CheckVersion(item.Version, version); err != nil {
+		return models.MenuItem{}, err
+	}
 
-	query := `UPDATE menu_items SET product_name = $1, description = $2, categories = $3, price = $4, updated_at = NOW() WHERE product_id = $5`
-	result, err := tx.Exec(query, item.Name, item.Description, pq.Array(item.Categories), item.Price, id)
+	query := `
+		UPDATE menu_items SET product_name = $1, description = $2, categories = $3, price = $4, version = version + 1, updated_at = NOW()
+		WHERE product_id = $5
+		RETURNING version`
+	err = tx.QueryRowContext(ctx, query, item.Name, item.Description, pq.Array(item.Categories), item.Price, id).Scan(&item.Version)
 	if err != nil {
 		return models.MenuItem{}, err
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return models.MenuItem{}, ErrNotFound
+
+	// Prices are stored with two decimals, so compare them in cents.
+	if math.Round(oldPrice*100) != math.Round(item.Price*100) {
+		historyQuery := `INSERT INTO price_history (product_id, old_price, new_price) VALUES ($1, $2, $3)`
+		_, err = tx.ExecContext(ctx, historyQuery, id, oldPrice, item.Price)
+		if err != nil {
+			return models.MenuItem{}, err
+		}
 	}
 
-	_, err = tx.Exec(`DELETE FROM menu_item_ingredients WHERE product_id = $1`, id)
+	_, err = tx.ExecContext(ctx, `DELETE FROM menu_item_ingredients WHERE product_id = $1`, id)
 	if err != nil {
 		return models.MenuItem{}, err
 	}
 
 	for _, ing := range item.Ingredients {
-		ingQuery := `INSERT INTO menu_item_ingredients (ingredient_id, product_id, quantity) VALUES ($1, $2, $3)`
-		_, err = tx.Exec(ingQuery, ing.IngredientID, id, ing.Quantity)
+		ingQuery := `INSERT INTO menu_item_ingredients (ingredient_id, product_id, quantity, unit) VALUES ($1, $2, $3, NULLIF($4, '')::inventory_unit)`
+		_, err = tx.ExecContext(ctx, ingQuery, ing.IngredientID, id, ing.Quantity, ing.Unit)
 		if err != nil {
 			return models.MenuItem{}, err
 		}
 	}
 
 	item.ID = id
-	return item, nil
+	return item, tx.Commit()
+}
+
+func (r *menuRepository) Archive(ctx context.Context, id, version int64) error {
+	return r.setArchived(ctx, id, version, true)
+}
+
+func (r *menuRepository) Restore(ctx context.Context, id, version int64) error {
+	return r.setArchived(ctx, id, version, false)
 }
 
-func (r *menuRepository) Delete(id int64) error {
-	query := `DELETE FROM menu_items WHERE product_id = $1`
-	result, err := r.db.Exec(query, id)
+func (r *menuRepository) setArchived(ctx context.Context, id, version int64, archived bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return ErrNotFound
+	defer tx.Rollback()
+
+	current, err := lockVersion(ctx, tx, "menu_items", "product_id", id)
+	if err != nil {
+		return err
+	}
+	if err := CheckVersion(version, current); err != nil {
+		return err
+	}
+
+	// The version is only bumped when archived_at actually changes.
+	query := `
+		UPDATE menu_items
+		SET archived_at = CASE WHEN $2 THEN NOW() END, version = version + 1, updated_at = NOW()
+		WHERE product_id = $1 AND (archived_at IS NULL) = $2`
+	if _, err := tx.ExecContext(ctx, query, id, archived); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *menuRepository) GetPriceHistory(ctx context.Context, id int64) ([]models.PriceChange, error) {
+	query := `
+		SELECT id, product_id, old_price, new_price, changed_at
+		FROM price_history
+		WHERE product_id = $1
+		ORDER BY changed_at, id`
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	var history []models.PriceChange
+	for rows.Next() {
+		var change models.PriceChange
+		if err := rows.Scan(&change.ID, &change.ProductID, &change.OldPrice, &change.NewPrice, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+func (r *menuRepository) GetAvailability(ctx context.Context) ([]models.MenuItemAvailability, error) {
+	query := `
+		SELECT m.product_id, m.product_name, lim.portions, COALESCE(lim.ingredient_id, 0), COALESCE(lim.name, '')
+		FROM menu_items m
+		LEFT JOIN LATERAL (
+			SELECT i.ingredient_id, i.name,
+			       FLOOR(i.quantity * unit_factor(i.unit) / (mii.quantity * unit_factor(COALESCE(mii.unit, i.unit))))::int AS portions
+			FROM menu_item_ingredients mii
+			JOIN inventory i ON i.ingredient_id = mii.ingredient_id
+			WHERE mii.product_id = m.product_id AND mii.quantity > 0
+			ORDER BY portions, i.ingredient_id
+			LIMIT 1
+		) lim ON true
+		WHERE m.archived_at IS NULL
+		ORDER BY m.product_id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var availability []models.MenuItemAvailability
+	for rows.Next() {
+		var a models.MenuItemAvailability
+		var portions sql.NullInt64
+		if err := rows.Scan(&a.ProductID, &a.ProductName, &portions, &a.LimitingIngredientID, &a.LimitingIngredient); err != nil {
+			return nil, err
+		}
+		if portions.Valid {
+			n := int(portions.Int64)
+			a.AvailablePortions = &n
+		}
+		availability = append(availability, a)
+	}
+	return availability, rows.Err()
+}
+
+func (r *menuRepository) ExistingIDs(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	return existingIDs(ctx, r.db, "menu_items", "product_id", ids)
 }
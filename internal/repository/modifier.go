@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/internal/apperr"
+	"frappuccino/models"
+
+	"github.com/lib/pq"
+)
+
+type ModifierRepository interface {
+	Create(ctx context.Context, m models.Modifier) (models.Modifier, error)
+	GetAll(ctx context.Context) ([]models.Modifier, error)
+	GetByID(ctx context.Context, id int64) (models.Modifier, error)
+	Update(ctx context.Context, id int64, m models.Modifier) (models.Modifier, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type modifierRepository struct {
+	db *sql.DB
+}
+
+func NewModifierRepository(db *sql.DB) ModifierRepository {
+	return &modifierRepository{db: db}
+}
+
+const modifierColumns = `
+	modifier_id, name, kind, price_delta,
+	COALESCE(replaces_ingredient_id, 0), COALESCE(substitute_ingredient_id, 0),
+	categories, created_at, updated_at`
+
+func (r *modifierRepository) Create(ctx context.Context, m models.Modifier) (models.Modifier, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Modifier{}, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO modifiers (name, kind, price_delta, replaces_ingredient_id, substitute_ingredient_id, categories)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING modifier_id, created_at, updated_at`
+	err = tx.QueryRowContext(ctx, query, m.Name, m.Kind, m.PriceDelta, nullID(m.ReplacesIngredientID), nullID(m.SubstituteIngredientID), pq.Array(m.Categories)).
+		Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return models.Modifier{}, modifierWriteError(err, m.Name)
+	}
+
+	if err := r.insertRelations(ctx, tx, m); err != nil {
+		return models.Modifier{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Modifier{}, err
+	}
+	return r.GetByID(ctx, m.ID)
+}
+
+func (r *modifierRepository) GetAll(ctx context.Context) ([]models.Modifier, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+modifierColumns+` FROM modifiers ORDER BY modifier_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var modifiers []models.Modifier
+	for rows.Next() {
+		m, err := scanModifier(rows)
+		if err != nil {
+			return nil, err
+		}
+		modifiers = append(modifiers, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadRelations(ctx, modifiers); err != nil {
+		return nil, err
+	}
+	return modifiers, nil
+}
+
+func (r *modifierRepository) GetByID(ctx context.Context, id int64) (models.Modifier, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+modifierColumns+` FROM modifiers WHERE modifier_id = $1`, id)
+	m, err := scanModifier(row)
+	if err == sql.ErrNoRows {
+		return models.Modifier{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Modifier{}, err
+	}
+
+	modifiers := []models.Modifier{m}
+	if err := r.loadRelations(ctx, modifiers); err != nil {
+		return models.Modifier{}, err
+	}
+	return modifiers[0], nil
+}
+
+func (r *modifierRepository) Update(ctx context.Context, id int64, m models.Modifier) (models.Modifier, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Modifier{}, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE modifiers
+		SET name = $1, kind = $2, price_delta = $3, replaces_ingredient_id = $4,
+		    substitute_ingredient_id = $5, categories = $6, updated_at = NOW()
+		WHERE modifier_id = $7`
+	result, err := tx.ExecContext(ctx, query, m.Name, m.Kind, m.PriceDelta, nullID(m.ReplacesIngredientID), nullID(m.SubstituteIngredientID), pq.Array(m.Categories), id)
+	if err != nil {
+		return models.Modifier{}, modifierWriteError(err, m.Name)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return models.Modifier{}, ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM modifier_ingredients WHERE modifier_id = $1`, id); err != nil {
+		return models.Modifier{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM modifier_products WHERE modifier_id = $1`, id); err != nil {
+		return models.Modifier{}, err
+	}
+
+	m.ID = id
+	if err := r.insertRelations(ctx, tx, m); err != nil {
+		return models.Modifier{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Modifier{}, err
+	}
+	return r.GetByID(ctx, id)
+}
+
+func (r *modifierRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM modifiers WHERE modifier_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *modifierRepository) insertRelations(ctx context.Context, tx *sql.Tx, m models.Modifier) error {
+	for _, ing := range m.Ingredients {
+		_, err := tx.ExecContext(ctx, `INSERT INTO modifier_ingredients (modifier_id, ingredient_id, quantity) VALUES ($1, $2, $3)`, m.ID, ing.IngredientID, ing.Quantity)
+		if err != nil {
+			return fmt.Errorf("failed to insert ingredient for modifier_id %d: %w", m.ID, err)
+		}
+	}
+	for _, productID := range m.ProductIDs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO modifier_products (modifier_id, product_id) VALUES ($1, $2)`, m.ID, productID)
+		if err != nil {
+			return fmt.Errorf("failed to insert product for modifier_id %d: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+func (r *modifierRepository) loadRelations(ctx context.Context, modifiers []models.Modifier) error {
+	if len(modifiers) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(modifiers))
+	index := make(map[int64]int, len(modifiers))
+	for i, m := range modifiers {
+		ids[i] = m.ID
+		index[m.ID] = i
+	}
+
+	query := `
+		SELECT mi.modifier_id, mi.ingredient_id, i.name, mi.quantity, i.unit
+		FROM modifier_ingredients mi
+		JOIN inventory i ON i.ingredient_id = mi.ingredient_id
+		WHERE mi.modifier_id = ANY($1)
+		ORDER BY mi.modifier_id, mi.ingredient_id`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var modifierID int64
+		var ing models.ModifierIngredient
+		if err := rows.Scan(&modifierID, &ing.IngredientID, &ing.ProductName, &ing.Quantity, &ing.Unit); err != nil {
+			return err
+		}
+		m := &modifiers[index[modifierID]]
+		m.Ingredients = append(m.Ingredients, ing)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	productRows, err := r.db.QueryContext(ctx, `
+		SELECT modifier_id, product_id
+		FROM modifier_products
+		WHERE modifier_id = ANY($1)
+		ORDER BY modifier_id, product_id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer productRows.Close()
+
+	for productRows.Next() {
+		var modifierID, productID int64
+		if err := productRows.Scan(&modifierID, &productID); err != nil {
+			return err
+		}
+		m := &modifiers[index[modifierID]]
+		m.ProductIDs = append(m.ProductIDs, productID)
+	}
+	return productRows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanModifier(row rowScanner) (models.Modifier, error) {
+	var m models.Modifier
+	err := row.Scan(
+		&m.ID, &m.Name, &m.Kind, &m.PriceDelta,
+		&m.ReplacesIngredientID, &m.SubstituteIngredientID,
+		pq.Array(&m.Categories), &m.CreatedAt, &m.UpdatedAt,
+	)
+	return m, err
+}
+
+// modifierWriteError turns a unique violation on the modifier name into a readable error.
+func modifierWriteError(err error, name string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return apperr.Conflict("modifier with name '%s' already exists", name)
+	}
+	return err
+}
@@ -1,21 +1,31 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"errors"
+	"encoding/json"
+	"frappuccino/internal/apperr"
 	"frappuccino/models"
-	"time"
+
+	"github.com/lib/pq"
 )
 
-var ErrNotFound = errors.New("not found")
+var ErrNotFound = apperr.ErrNotFound
 
 type OrderRepository interface {
-	GetNumberOfOrderedItems(startDate, endDate string) (map[string]int, error)
-	CreateTx(tx *sql.Tx, order models.Order) (models.Order, error)
-	GetAll() ([]models.Order, error)
-	GetByID(id int64) (models.Order, error)
-	Update(id int64, order models.Order) (models.Order, error)
-	Delete(id int64) error
+	GetNumberOfOrderedItems(ctx context.Context, startDate, endDate string) (map[string]int, error)
+	CreateTx(ctx context.Context, tx *sql.Tx, order models.Order) (models.Order, error)
+	GetAll(ctx context.Context) ([]models.Order, error)
+	List(ctx context.Context, filter models.OrderFilter, page models.PageRequest) ([]models.Order, error)
+	GetByID(ctx context.Context, id int64) (models.Order, error)
+	GetForUpdateTx(ctx context.Context, tx *sql.Tx, id int64) (models.Order, error)
+	UpdateTx(ctx context.Context, tx *sql.Tx, order models.Order) error
+	DeleteTx(ctx context.Context, tx *sql.Tx, id int64) error
+	AddItemTx(ctx context.Context, tx *sql.Tx, orderID int64, item models.OrderItem) error
+	SetItemQuantityTx(ctx context.Context, tx *sql.Tx, itemID int64, quantity int) error
+	DeleteItemTx(ctx context.Context, tx *sql.Tx, itemID int64) error
+	GetStatusForUpdateTx(ctx context.Context, tx *sql.Tx, id int64) (models.OrderStatus, error)
+	SetStatusTx(ctx context.Context, tx *sql.Tx, id int64, status models.OrderStatus) error
 }
 
 type orderRepository struct {
@@ -26,9 +36,53 @@ func NewOrderRepository(db *sql.DB) OrderRepository {
 	return &orderRepository{db: db}
 }
 
-func (r *orderRepository) GetAll() ([]models.Order, error) {
-	query := `SELECT order_id, customer_name, total_price, status, created_at FROM orders ORDER BY order_id DESC`
-	rows, err := r.db.Query(query)
+const orderColumns = `order_id, customer_name, total_price, status, version, created_at`
+
+func scanOrder(row rowScanner) (models.Order, error) {
+	var order models.Order
+	err := row.Scan(&order.ID, &order.CustomerName, &order.TotalPrice, &order.Status, &order.Version, &order.CreatedAt)
+	return order, err
+}
+
+var orderSortColumns = map[string]sortColumn{
+	"id":            {expr: "order_id", cast: "bigint"},
+	"created_at":    {expr: "created_at", cast: "timestamptz"},
+	"total_price":   {expr: "total_price", cast: "numeric"},
+	"customer_name": {expr: "customer_name", cast: "text"},
+}
+
+func (r *orderRepository) GetAll(ctx context.Context) ([]models.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders ORDER BY order_id DESC`
+	return r.queryOrders(ctx, query)
+}
+
+func (r *orderRepository) List(ctx context.Context, filter models.OrderFilter, page models.PageRequest) ([]models.Order, error) {
+	col, err := sortColumnFor(orderSortColumns, page.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var q listQuery
+	if filter.Status != "" {
+		q.where("status = " + q.arg(filter.Status))
+	}
+	if filter.Customer != "" {
+		q.where("customer_name ILIKE '%' || " + q.arg(filter.Customer) + " || '%'")
+	}
+	if !filter.From.IsZero() {
+		q.where("created_at >= " + q.arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		q.where("created_at < " + q.arg(filter.To))
+	}
+	orderBy := q.paginate(col, "order_id", page)
+
+	query := `SELECT ` + orderColumns + ` FROM orders ` + q.whereClause() + ` ` + orderBy
+	return r.queryOrders(ctx, query, q.args...)
+}
+
+func (r *orderRepository) queryOrders(ctx context.Context, query string, args ...any) ([]models.Order, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -36,28 +90,52 @@ func (r *orderRepository) GetAll() ([]models.Order, error) {
 
 	var orders []models.Order
 	for rows.Next() {
-		var order models.Order
-		if err := rows.Scan(&order.ID, &order.CustomerName, &order.TotalPrice, &order.Status, &order.CreatedAt); err != nil {
-			return nil, err
-		}
-
-		order.Items, err = r.getOrderItems(order.ID)
+		order, err := scanOrder(rows)
 		if err != nil {
 			return nil, err
 		}
-
 		orders = append(orders, order)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+	items, err := getOrderItems(ctx, r.db, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].ID]
+	}
 	return orders, nil
 }
 
-func (r *orderRepository) GetByID(id int64) (models.Order, error) {
-	var order models.Order
+func (r *orderRepository) GetByID(ctx context.Context, id int64) (models.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE order_id = $1`
+	order, err := scanOrder(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return models.Order{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
 
-	query := `SELECT order_id, customer_name, total_price, status, created_at FROM orders WHERE order_id = $1`
-	err := r.db.QueryRow(query, id).Scan(
-		&order.ID, &order.CustomerName, &order.TotalPrice, &order.Status, &order.CreatedAt,
-	)
+	items, err := getOrderItems(ctx, r.db, order.ID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	order.Items = items[order.ID]
+
+	return order, nil
+}
+
+func (r *orderRepository) GetForUpdateTx(ctx context.Context, tx *sql.Tx, id int64) (models.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE order_id = $1 FOR UPDATE`
+	order, err := scanOrder(tx.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return models.Order{}, ErrNotFound
 	}
@@ -65,36 +143,34 @@ func (r *orderRepository) GetByID(id int64) (models.Order, error) {
 		return models.Order{}, err
 	}
 
-	order.Items, err = r.getOrderItems(order.ID)
+	items, err := getOrderItems(ctx, tx, order.ID)
 	if err != nil {
 		return models.Order{}, err
 	}
+	order.Items = items[order.ID]
 
 	return order, nil
 }
 
-func (r *orderRepository) Update(id int64, updatedOrder models.Order) (models.Order, error) {
+func (r *orderRepository) UpdateTx(ctx context.Context, tx *sql.Tx, order models.Order) error {
 	query := `
         UPDATE orders
-        SET customer_name = $1,total_price = $2, status = $3, updated_at = $5
-        WHERE order_id = $4`
-	updated_at := time.Now()
-	result, err := r.db.Exec(query, updatedOrder.CustomerName, updatedOrder.TotalPrice, updatedOrder.Status, id, updated_at)
+        SET customer_name = $1, total_price = $2, version = version + 1, updated_at = CURRENT_TIMESTAMP
+        WHERE order_id = $3`
+	result, err := tx.ExecContext(ctx, query, order.CustomerName, order.TotalPrice, order.ID)
 	if err != nil {
-		return models.Order{}, err
+		return err
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return models.Order{}, ErrNotFound
+		return ErrNotFound
 	}
-
-	updatedOrder.ID = id
-	return updatedOrder, nil
+	return nil
 }
 
-func (r *orderRepository) Delete(id int64) error {
-	result, err := r.db.Exec(`DELETE FROM orders WHERE order_id = $1`, id)
+func (r *orderRepository) DeleteTx(ctx context.Context, tx *sql.Tx, id int64) error {
+	result, err := tx.ExecContext(ctx, `DELETE FROM orders WHERE order_id = $1`, id)
 	if err != nil {
 		return err
 	}
@@ -107,114 +183,138 @@ func (r *orderRepository) Delete(id int64) error {
 	return nil
 }
 
-func (r *orderRepository) CreateTx(tx *sql.Tx, order models.Order) (models.Order, error) {
+func (r *orderRepository) CreateTx(ctx context.Context, tx *sql.Tx, order models.Order) (models.Order, error) {
 	query := `
-		INSERT INTO orders (customer_name, total_price, status, created_at)
-		VALUES ($1, $2, $3, $4) 
-		RETURNING order_id`
-	err := tx.QueryRow(query, order.CustomerName, order.TotalPrice, order.Status, order.CreatedAt).Scan(&order.ID)
+		INSERT INTO orders (customer_name, total_price, status)
+		VALUES ($1, $2, $3)
+		RETURNING order_id, version, created_at`
+	err := tx.QueryRowContext(ctx, query, order.CustomerName, order.TotalPrice, order.Status).Scan(&order.ID, &order.Version, &order.CreatedAt)
 	if err != nil {
 		return models.Order{}, err
 	}
 
-	ingredientNeeds := make(map[int64]int)
-
 	for _, item := range order.Items {
-		ingredients, err := r.GetIngredientsByProductID(item.ProductID)
-		if err != nil {
-			return models.Order{}, err
-		}
-
-		for _, ing := range ingredients {
-			ingredientNeeds[ing.IngredientID] += ing.Quantity * item.Quantity
-		}
-
-		itemQuery := `
-			INSERT INTO order_items (order_id, product_id, quantity)
-			VALUES ($1, $2, $3)`
-		_, err = tx.Exec(itemQuery, order.ID, item.ProductID, item.Quantity)
-		if err != nil {
-			return models.Order{}, err
-		}
-	}
-
-	for ingID, totalQty := range ingredientNeeds {
-		err := r.UpdateInventory(tx, ingID, totalQty)
-		if err != nil {
+		if err := r.AddItemTx(ctx, tx, order.ID, item); err != nil {
 			return models.Order{}, err
 		}
 	}
 
-	err = tx.Commit()
-	if err != nil {
+	if err := r.addStatusHistory(ctx, tx, order.ID, order.Status); err != nil {
 		return models.Order{}, err
 	}
 
 	return order, nil
 }
 
-func (r *orderRepository) GetIngredientsByProductID(productID int64) ([]models.MenuItemIngredient, error) {
+func (r *orderRepository) AddItemTx(ctx context.Context, tx *sql.Tx, orderID int64, item models.OrderItem) error {
+	customization, err := json.Marshal(item.Customization)
+	if err != nil {
+		return err
+	}
+	uses := item.Consumption
+	if uses == nil {
+		uses = []models.IngredientUse{}
+	}
+	consumption, err := json.Marshal(uses)
+	if err != nil {
+		return err
+	}
+
 	query := `
-	SELECT mi.ingredient_id, inv.name, mi.quantity
-	FROM menu_item_ingredients mi
-	JOIN inventory inv ON inv.ingredient_id = mi.ingredient_id
-	WHERE mi.product_id = $1`
+		INSERT INTO order_items (order_id, product_id, quantity, unit_price, customization, consumption)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(ctx, query, orderID, item.ProductID, item.Quantity, item.UnitPrice, customization, consumption)
+	return err
+}
 
-	rows, err := r.db.Query(query, productID)
+func (r *orderRepository) SetItemQuantityTx(ctx context.Context, tx *sql.Tx, itemID int64, quantity int) error {
+	result, err := tx.ExecContext(ctx, `UPDATE order_items SET quantity = $1 WHERE id = $2`, quantity, itemID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	var ingredients []models.MenuItemIngredient
-	for rows.Next() {
-		var ing models.MenuItemIngredient
-		if err := rows.Scan(&ing.IngredientID, &ing.ProductName, &ing.Quantity); err != nil {
-			return nil, err
-		}
-		ingredients = append(ingredients, ing)
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
 	}
-	return ingredients, nil
+	return nil
 }
 
-func (r *orderRepository) UpdateInventory(tx *sql.Tx, ingredientID int64, quantity int) error {
-	query := `UPDATE inventory SET quantity = quantity - $1 WHERE ingredient_id = $2 AND quantity >= $1`
-	result, err := tx.Exec(query, quantity, ingredientID)
+func (r *orderRepository) DeleteItemTx(ctx context.Context, tx *sql.Tx, itemID int64) error {
+	result, err := tx.ExecContext(ctx, `DELETE FROM order_items WHERE id = $1`, itemID)
 	if err != nil {
 		return err
 	}
-	affected, _ := result.RowsAffected()
-	if affected == 0 {
-		return errors.New("not enough inventory")
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
 	}
 	return nil
 }
 
-func (r *orderRepository) getOrderItems(orderID int64) ([]models.OrderItem, error) {
+func (r *orderRepository) GetStatusForUpdateTx(ctx context.Context, tx *sql.Tx, id int64) (models.OrderStatus, error) {
+	var status models.OrderStatus
+	err := tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE order_id = $1 FOR UPDATE`, id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return status, err
+}
+
+func (r *orderRepository) SetStatusTx(ctx context.Context, tx *sql.Tx, id int64, status models.OrderStatus) error {
+	result, err := tx.ExecContext(ctx, `UPDATE orders SET status = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE order_id = $2`, status, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return r.addStatusHistory(ctx, tx, id, status)
+}
+
+func (r *orderRepository) addStatusHistory(ctx context.Context, tx *sql.Tx, orderID int64, status models.OrderStatus) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO order_status_history (order_id, status) VALUES ($1, $2)`, orderID, status)
+	return err
+}
+
+func getOrderItems(ctx context.Context, q queryer, orderIDs ...int64) (map[int64][]models.OrderItem, error) {
+	items := make(map[int64][]models.OrderItem, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return items, nil
+	}
+
 	query := `
-		SELECT oi.product_id, p.product_name, oi.quantity
+		SELECT oi.order_id, oi.id, oi.product_id, p.product_name, oi.quantity, oi.unit_price, COALESCE(oi.customization, '{}'), oi.consumption
 		FROM order_items oi
 		JOIN menu_items p ON oi.product_id = p.product_id
-		WHERE oi.order_id = $1`
-	rows, err := r.db.Query(query, orderID)
+		WHERE oi.order_id = ANY($1)
+		ORDER BY oi.id`
+	rows, err := q.QueryContext(ctx, query, pq.Array(orderIDs))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var items []models.OrderItem
 	for rows.Next() {
+		var orderID int64
 		var item models.OrderItem
-		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.Quantity); err != nil {
+		var customization, consumption []byte
+		if err := rows.Scan(&orderID, &item.ID, &item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPrice, &customization, &consumption); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(customization, &item.Customization); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(consumption, &item.Consumption); err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		items[orderID] = append(items[orderID], item)
 	}
 
-	return items, nil
+	return items, rows.Err()
 }
 
-func (r *orderRepository) GetNumberOfOrderedItems(startDate, endDate string) (map[string]int, error) {
+func (r *orderRepository) GetNumberOfOrderedItems(ctx context.Context, startDate, endDate string) (map[string]int, error) {
 	query := `
 	SELECT mi.product_name, SUM(oi.quantity) as total_quantity
 	FROM order_items oi
@@ -225,7 +325,7 @@ func (r *orderRepository) GetNumberOfOrderedItems(startDate, endDate string) (ma
 	GROUP BY mi.product_name;
 `
 
-	rows, err := r.db.Query(query, startDate, endDate)
+	rows, err := r.db.QueryContext(ctx, query, startDate, endDate)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"frappuccino/models"
@@ -9,9 +10,10 @@ import (
 )
 
 type ReportRepository interface {
-	SearchReports(query string, filters []string, minPrice, maxPrice float64) (models.SearchReportResponse, error)
-	GetOrderedItemsByDay(year int, month time.Month) (map[int]int, error)
-	GetOrderedItemsByMonth(year int) (map[string]int, error)
+	GetTotalSales(ctx context.Context) (float64, error)
+	SearchReports(ctx context.Context, query string, filters []string, minPrice, maxPrice float64) (models.SearchReportResponse, error)
+	GetOrderedItemsByDay(ctx context.Context, year int, month time.Month) (map[int]int, error)
+	GetOrderedItemsByMonth(ctx context.Context, year int) (map[string]int, error)
 }
 
 type reportRepository struct {
@@ -22,7 +24,13 @@ func NewReportRepository(db *sql.DB) ReportRepository {
 	return &reportRepository{db}
 }
 
-func (r *reportRepository) SearchReports(query string, filters []string, minPrice, maxPrice float64) (models.SearchReportResponse, error) {
+func (r *reportRepository) GetTotalSales(ctx context.Context) (float64, error) {
+	var total float64
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(total_price), 0) FROM orders WHERE status = 'closed'`).Scan(&total)
+	return total, err
+}
+
+func (r *reportRepository) SearchReports(ctx context.Context, query string, filters []string, minPrice, maxPrice float64) (models.SearchReportResponse, error) {
 	response := models.SearchReportResponse{}
 	searchQuery := fmt.Sprintf("plainto_tsquery('english', $1)")
 
@@ -33,10 +41,11 @@ func (r *reportRepository) SearchReports(query string, filters []string, minPric
 			FROM menu_items
 			WHERE to_tsvector('english', product_name || ' ' || description) @@ ` + searchQuery + `
 			AND price BETWEEN $2 AND $3
+			AND archived_at IS NULL
 			ORDER BY relevance DESC;
 		`
 
-		rows, err := r.db.Query(menuSQL, query, minPrice, maxPrice)
+		rows, err := r.db.QueryContext(ctx, menuSQL, query, minPrice, maxPrice)
 		if err != nil {
 			return response, err
 		}
@@ -61,7 +70,7 @@ func (r *reportRepository) SearchReports(query string, filters []string, minPric
 			ORDER BY relevance DESC;
 		`
 
-		rows, err := r.db.Query(orderSQL, query, minPrice, maxPrice)
+		rows, err := r.db.QueryContext(ctx, orderSQL, query, minPrice, maxPrice)
 		if err != nil {
 			return response, err
 		}
@@ -73,7 +82,7 @@ func (r *reportRepository) SearchReports(query string, filters []string, minPric
 				return response, err
 			}
 			// fetch item names for order
-			itemsRows, err := r.db.Query(`
+			itemsRows, err := r.db.QueryContext(ctx, `
 				SELECT mi.product_name
 				FROM order_items oi
 				JOIN menu_items mi ON oi.product_id = mi.product_id
@@ -105,7 +114,7 @@ func contains(slice []string, value string) bool {
 	return false
 }
 
-func (r *reportRepository) GetOrderedItemsByDay(year int, month time.Month) (map[int]int, error) {
+func (r *reportRepository) GetOrderedItemsByDay(ctx context.Context, year int, month time.Month) (map[int]int, error) {
 	query := `
 		SELECT EXTRACT(DAY FROM day) AS day, COUNT(*) AS count
 		FROM (
@@ -115,7 +124,7 @@ func (r *reportRepository) GetOrderedItemsByDay(year int, month time.Month) (map
     	AND created_at <  DATE_TRUNC('month', MAKE_DATE($1, $2, 1)) + INTERVAL '1 month') sub
 		GROUP BY day
 		ORDER BY day;`
-	rows, err := r.db.Query(query, year, int(month))
+	rows, err := r.db.QueryContext(ctx, query, year, int(month))
 	if err != nil {
 		return nil, err
 	}
@@ -133,14 +142,14 @@ func (r *reportRepository) GetOrderedItemsByDay(year int, month time.Month) (map
 	return result, nil
 }
 
-func (r *reportRepository) GetOrderedItemsByMonth(year int) (map[string]int, error) {
+func (r *reportRepository) GetOrderedItemsByMonth(ctx context.Context, year int) (map[string]int, error) {
 	query := `
 		SELECT TO_CHAR(created_at, 'Month') as month, COUNT(*) as count
 		FROM orders
 		WHERE EXTRACT(YEAR FROM created_at) = $1
 		GROUP BY month
 		ORDER BY MIN(created_at)`
-	rows, err := r.db.Query(query, year)
+	rows, err := r.db.QueryContext(ctx, query, year)
 	if err != nil {
 		return nil, err
 	}
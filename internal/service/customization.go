@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"frappuccino/internal/apperr"
+	"frappuccino/internal/repository"
+	"frappuccino/models"
+	"log"
+
+	"github.com/shopspring/decimal"
+)
+
+func (s *orderService) customizeLine(
+	ctx context.Context,
+	menuItem models.MenuItem,
+	customization models.Customization,
+	modifierCache map[int64]models.Modifier,
+) (models.Customization, float64, ingredientNeeds, error) {
+	ingredients := make(ingredientNeeds, len(menuItem.Ingredients))
+	for _, ing := range menuItem.Ingredients {
+		if err := ingredients.add(ing.IngredientID, ing.Quantity, ing.Unit); err != nil {
+			return models.Customization{}, 0, nil, apperr.Conflict("recipe of %s: %s: %v", menuItem.Name, ing.ProductName, err)
+		}
+	}
+	price := menuItem.Price
+
+	seen := make(map[int64]bool, len(customization.Modifiers))
+	applied := make([]models.AppliedModifier, 0, len(customization.Modifiers))
+	for _, selection := range customization.Modifiers {
+		if seen[selection.ModifierID] {
+			return models.Customization{}, 0, nil, apperr.Validation("modifier '%d' is listed more than once", selection.ModifierID)
+		}
+		seen[selection.ModifierID] = true
+
+		quantity := selection.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+		if quantity < 0 {
+			return models.Customization{}, 0, nil, apperr.Validation("modifier '%d' quantity must be positive", selection.ModifierID)
+		}
+
+		modifier, ok := modifierCache[selection.ModifierID]
+		if !ok {
+			var err error
+			modifier, err = s.modifierRepo.GetByID(ctx, selection.ModifierID)
+			if err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					return models.Customization{}, 0, nil, apperr.Validation("modifier '%d' not found", selection.ModifierID)
+				}
+				log.Print("Failed to load modifier", "modifier_id", selection.ModifierID, "error", err)
+				return models.Customization{}, 0, nil, err
+			}
+			modifierCache[selection.ModifierID] = modifier
+		}
+		if !modifier.AppliesTo(menuItem) {
+			return models.Customization{}, 0, nil, apperr.Validation("%s cannot be applied to %s", modifier.Name, menuItem.Name)
+		}
+
+		switch modifier.Kind {
+		case models.ModifierSubstitute:
+			if quantity != 1 {
+				return models.Customization{}, 0, nil, apperr.Validation("%s can only be applied once", modifier.Name)
+			}
+			need, ok := ingredients[modifier.ReplacesIngredientID]
+			if !ok {
+				return models.Customization{}, 0, nil, apperr.Validation("%s cannot be applied to %s", modifier.Name, menuItem.Name)
+			}
+			delete(ingredients, modifier.ReplacesIngredientID)
+			if err := ingredients.add(modifier.SubstituteIngredientID, need.amount, need.unit); err != nil {
+				return models.Customization{}, 0, nil, apperr.Conflict("%s on %s: %v", modifier.Name, menuItem.Name, err)
+			}
+		default:
+			for _, ing := range modifier.Ingredients {
+				if err := ingredients.add(ing.IngredientID, ing.Quantity.Mul(decimal.NewFromInt(int64(quantity))), ing.Unit); err != nil {
+					return models.Customization{}, 0, nil, apperr.Conflict("%s on %s: %s: %v", modifier.Name, menuItem.Name, ing.ProductName, err)
+				}
+			}
+		}
+
+		price += modifier.PriceDelta * float64(quantity)
+		applied = append(applied, models.AppliedModifier{
+			ModifierID: modifier.ID,
+			Name:       modifier.Name,
+			Quantity:   quantity,
+			PriceDelta: modifier.PriceDelta,
+		})
+	}
+
+	return models.Customization{Modifiers: applied}, roundPrice(price), ingredients, nil
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"frappuccino/internal/apperr"
+	"frappuccino/internal/repository"
+	"frappuccino/models"
+	"time"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// ErrIdempotencyKeyTaken is not an apperr.Error, whose errors.Is matches any
+// error of the same code.
+var ErrIdempotencyKeyTaken = errors.New("idempotency key was claimed by a concurrent request")
+
+type IdempotencyService interface {
+	Begin(ctx context.Context, key string, request any) (models.IdempotencyRecord, error)
+}
+
+type IdempotentResponse struct {
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Render      func(models.Order) ([]byte, error)
+}
+
+type idempotencyService struct {
+	repo   repository.IdempotencyRepository
+	window time.Duration
+}
+
+func NewIdempotencyService(repo repository.IdempotencyRepository, window time.Duration) IdempotencyService {
+	return &idempotencyService{repo: repo, window: window}
+}
+
+// Begin returns the stored record to replay, or one with StatusCode 0 to claim.
+func (s *idempotencyService) Begin(ctx context.Context, key string, request any) (models.IdempotencyRecord, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return models.IdempotencyRecord{}, apperr.Validation("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength)
+	}
+	hash, err := requestHash(request)
+	if err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+
+	record, err := s.repo.Get(ctx, key, time.Now().Add(-s.window))
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.IdempotencyRecord{Key: key, RequestHash: hash}, nil
+	}
+	if err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+	if record.RequestHash != hash {
+		return models.IdempotencyRecord{}, apperr.IdempotencyMismatch("Idempotency-Key %q was already used with a different request", key)
+	}
+	return record, nil
+}
+
+// requestHash ignores whitespace and field order.
+func requestHash(request any) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
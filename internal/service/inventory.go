@@ -1,92 +1,327 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"database/sql"
+	"fmt"
+	"frappuccino/internal/apperr"
 	"frappuccino/internal/repository"
+	"frappuccino/internal/validation"
 	"frappuccino/models"
+	"log"
+	"strings"
+
+	"github.com/shopspring/decimal"
 )
 
 type InventoryService interface {
-	CreateInventoryItem(name string, quantity int, unit string) (models.InventoryItem, error)
-	GetInventoryItems() ([]models.InventoryItem, error)
-	GetInventoryItem(id int64) (models.InventoryItem, error)
-	UpdateInventoryItem(item models.InventoryItem) (models.InventoryItem, error)
-	DeleteInventoryItem(id int64) error
-	GetLeftOvers(sortBy string, page, pageSize int) ([]models.InventoryItem, int, error)
+	CreateInventoryItem(ctx context.Context, item models.InventoryItem) (models.InventoryItem, error)
+	GetInventoryItems(ctx context.Context, filter models.InventoryFilter, page models.PageRequest, cursor string) ([]models.InventoryItem, string, error)
+	GetInventoryItem(ctx context.Context, id int64) (models.InventoryItem, error)
+	UpdateInventoryItem(ctx context.Context, update models.InventoryUpdate) (models.InventoryItem, error)
+	DeleteInventoryItem(ctx context.Context, id, version int64, deletion models.InventoryDeletion) error
+	GetLeftOvers(ctx context.Context, sortBy string, desc bool, page, pageSize int) ([]models.StockLevel, int, error)
+	RecordMovement(ctx context.Context, id int64, kind models.TransactionType, delta decimal.Decimal, unitCost *float64, note string) (models.InventoryItem, error)
+	GetTransactions(ctx context.Context, id int64, startDate, endDate string, page, pageSize int) ([]models.InventoryTransaction, int, error)
+}
+
+type IngredientInUseError struct {
+	Name       string
+	Dependents models.IngredientDependents
+}
+
+func (e *IngredientInUseError) Error() string {
+	var parts []string
+	if n := len(e.Dependents.MenuItems); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d menu item(s)", n))
+	}
+	if n := len(e.Dependents.Modifiers); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d modifier(s)", n))
+	}
+	return fmt.Sprintf("%s is used by %s; pass replacement_id to rewrite them or force=true to drop it from them",
+		e.Name, strings.Join(parts, " and "))
 }
 
 type inventoryService struct {
 	repo repository.InventoryRepository
+	db   *sql.DB
 }
 
-func NewInventoryService(repo repository.InventoryRepository) InventoryService {
-	return &inventoryService{repo: repo}
+func NewInventoryService(repo repository.InventoryRepository, db *sql.DB) InventoryService {
+	return &inventoryService{repo: repo, db: db}
 }
 
-func (s *inventoryService) CreateInventoryItem(name string, quantity int, unit string) (models.InventoryItem, error) {
-	if name == "" {
-		return models.InventoryItem{}, errors.New("name is required")
-	}
-	if quantity < 0 {
-		return models.InventoryItem{}, errors.New("quantity cannot be negative")
-	}
-	if unit == "" {
-		return models.InventoryItem{}, errors.New("unit is required")
+func (s *inventoryService) CreateInventoryItem(ctx context.Context, item models.InventoryItem) (models.InventoryItem, error) {
+	if err := validateInventoryItem(item); err != nil {
+		return models.InventoryItem{}, err
 	}
 
-	// Create new inventory item with generated ID
-	item := models.NewInventoryItem(name, quantity, unit)
-
-	return s.repo.Create(item)
+	return s.repo.Create(ctx, item)
 }
 
-func (s *inventoryService) GetInventoryItems() ([]models.InventoryItem, error) {
-	return s.repo.GetAll()
+func (s *inventoryService) GetInventoryItems(ctx context.Context, filter models.InventoryFilter, page models.PageRequest, cursor string) ([]models.InventoryItem, string, error) {
+	var v validation.Errors
+	if filter.Unit != "" {
+		v.OneOf("unit", filter.Unit, models.Units)
+	}
+	page = preparePage(&v, page, cursor, models.InventorySortKeys, "id", false)
+	if err := v.Err(); err != nil {
+		return nil, "", err
+	}
+
+	items, err := s.repo.List(ctx, filter, page)
+	if err != nil {
+		return nil, "", err
+	}
+	items, next := trimPage(items, page, func(item models.InventoryItem) (string, int64) {
+		switch page.Sort {
+		case "name":
+			return item.Name, item.IngredientID
+		case "quantity":
+			return item.Quantity.String(), item.IngredientID
+		}
+		return formatID(item.IngredientID), item.IngredientID
+	})
+	return items, next, nil
 }
 
-func (s *inventoryService) GetInventoryItem(id int64) (models.InventoryItem, error) {
+func (s *inventoryService) GetInventoryItem(ctx context.Context, id int64) (models.InventoryItem, error) {
 	if id == 0 {
-		return models.InventoryItem{}, errors.New("id is required")
+		return models.InventoryItem{}, apperr.Validation("id is required")
 	}
-	return s.repo.GetByID(id)
+	return s.repo.GetByID(ctx, id)
 }
 
-func (s *inventoryService) DeleteInventoryItem(id int64) error {
-	if id == 0 {
-		return errors.New("id is required")
+// DeleteInventoryItem refuses to remove an item that menu items or modifiers
+// use, unless deletion names a replacement or forces it.
+func (s *inventoryService) DeleteInventoryItem(ctx context.Context, id, version int64, deletion models.InventoryDeletion) error {
+	var v validation.Errors
+	v.Check(id != 0, "id", "is required")
+	v.Check(deletion.ReplacementID >= 0, "replacement_id", "must be positive")
+	v.Check(deletion.ReplacementID == 0 || deletion.ReplacementID != id, "replacement_id", "cannot be the item being deleted")
+	v.Check(deletion.ReplacementID == 0 || !deletion.Force, "force", "cannot be combined with replacement_id")
+	if err := v.Err(); err != nil {
+		return err
 	}
-	return s.repo.Delete(id)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Print("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids := []int64{id}
+	if deletion.ReplacementID != 0 {
+		ids = append(ids, deletion.ReplacementID)
+	}
+	stock, err := s.repo.GetForUpdateTx(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+	item, ok := stock[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if err := repository.CheckVersion(version, item.Version); err != nil {
+		return err
+	}
+
+	dependents, err := s.repo.GetDependentsTx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case deletion.ReplacementID != 0:
+		replacement, ok := stock[deletion.ReplacementID]
+		if !ok {
+			return apperr.Validation("replacement ingredient '%d' does not exist", deletion.ReplacementID)
+		}
+		if !models.UnitsCompatible(item.Unit, replacement.Unit) {
+			return apperr.Conflict("cannot replace %s, measured in %s, with %s, measured in %s",
+				item.Name, item.Unit, replacement.Name, replacement.Unit)
+		}
+		if !dependents.Empty() {
+			if err := s.repo.ReplaceIngredientTx(ctx, tx, id, deletion.ReplacementID); err != nil {
+				return err
+			}
+		}
+	case !deletion.Force && !dependents.Empty():
+		inUse := &IngredientInUseError{Name: item.Name, Dependents: dependents}
+		return apperr.Wrap(apperr.CodeConflict, inUse).WithDetails(dependents)
+	}
+
+	if err := s.repo.DeleteTx(ctx, tx, id); err != nil {
+		log.Print("Failed to delete inventory item", "id", id, "error", err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Print("Failed to commit transaction", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
-func (s *inventoryService) UpdateInventoryItem(item models.InventoryItem) (models.InventoryItem, error) {
-	if item.IngredientID == 0 {
-		return models.InventoryItem{}, errors.New("id is required")
+func (s *inventoryService) UpdateInventoryItem(ctx context.Context, update models.InventoryUpdate) (models.InventoryItem, error) {
+	if update.IngredientID == 0 {
+		return models.InventoryItem{}, apperr.Validation("id is required")
+	}
+	if err := validateInventoryUpdate(update); err != nil {
+		return models.InventoryItem{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Print("Failed to begin transaction", "error", err)
+		return models.InventoryItem{}, fmt.Errorf("failed to start transaction: %w", err)
 	}
-	if item.Name == "" {
-		return models.InventoryItem{}, errors.New("name is required")
+	defer tx.Rollback()
+
+	stock, err := s.repo.GetForUpdateTx(ctx, tx, []int64{update.IngredientID})
+	if err != nil {
+		return models.InventoryItem{}, err
 	}
-	if item.Quantity < 0 {
-		return models.InventoryItem{}, errors.New("quantity cannot be negative")
+	current, ok := stock[update.IngredientID]
+	if !ok {
+		return models.InventoryItem{}, repository.ErrNotFound
 	}
-	if item.Unit == "" {
-		return models.InventoryItem{}, errors.New("unit is required")
+	if err := repository.CheckVersion(update.Version, current.Version); err != nil {
+		return models.InventoryItem{}, err
 	}
 
-	return s.repo.Update(item)
+	if update.Unit != current.Unit {
+		if current, err = s.changeUnit(ctx, tx, current, update.Unit); err != nil {
+			return models.InventoryItem{}, err
+		}
+	}
+	item := current
+	item.Name = update.Name
+	if update.Quantity != nil {
+		item.Quantity = *update.Quantity
+	}
+	if update.ReorderLevel != nil {
+		item.ReorderLevel = *update.ReorderLevel
+	}
+	if update.CostPerUnit != nil {
+		item.CostPerUnit = *update.CostPerUnit
+	}
+
+	updated, err := s.repo.UpdateTx(ctx, tx, current, item)
+	if err != nil {
+		log.Print("Failed to update inventory item", "id", item.IngredientID, "error", err)
+		return models.InventoryItem{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Print("Failed to commit transaction", "error", err)
+		return models.InventoryItem{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
 }
 
-func (s *inventoryService) GetLeftOvers(sortBy string, page, pageSize int) ([]models.InventoryItem, int, error) {
-	if page <= 0 {
-		page = 1
+// changeUnit refuses a change of kind while recipes or modifiers use the item,
+// since their quantities would lose their meaning.
+func (s *inventoryService) changeUnit(ctx context.Context, tx *sql.Tx, current models.InventoryItem, unit string) (models.InventoryItem, error) {
+	if !models.UnitsCompatible(current.Unit, unit) {
+		dependents, err := s.repo.GetDependentsTx(ctx, tx, current.IngredientID)
+		if err != nil {
+			return models.InventoryItem{}, err
+		}
+		if !dependents.Empty() {
+			return models.InventoryItem{}, apperr.Conflict("cannot change the unit of %s from %s to %s while recipes or modifiers use it",
+				current.Name, current.Unit, unit).WithDetails(dependents)
+		}
+		current.Unit = unit
+		return current, nil
 	}
-	if pageSize <= 0 {
-		pageSize = 10
+
+	quantity, _ := models.ConvertQuantity(current.Quantity, current.Unit, unit)
+	reorderLevel, _ := models.ConvertQuantity(current.ReorderLevel, current.Unit, unit)
+	if !hasQuantityPlaces(quantity) || !hasQuantityPlaces(reorderLevel) {
+		return models.InventoryItem{}, apperr.Conflict("the stock of %s cannot be expressed in %s with %d decimal places",
+			current.Name, unit, models.QuantityPlaces)
+	}
+	// One unit of the new kind holds perUnit of the old one, and costs that much more.
+	perUnit, _ := models.ConvertQuantity(decimal.NewFromInt(1), unit, current.Unit)
+	cost, _ := decimal.NewFromFloat(current.CostPerUnit).Mul(perUnit).Round(4).Float64()
+
+	if err := s.repo.ConvertUnitTx(ctx, tx, current.IngredientID, current.Unit, unit); err != nil {
+		return models.InventoryItem{}, err
+	}
+	current.Unit, current.Quantity, current.ReorderLevel, current.CostPerUnit = unit, quantity, reorderLevel, cost
+	return current, nil
+}
+
+const consumptionWindowDays = 30
+
+func (s *inventoryService) GetLeftOvers(ctx context.Context, sortBy string, desc bool, page, pageSize int) ([]models.StockLevel, int, error) {
+	if sortBy == "" {
+		sortBy = "days_of_cover"
 	}
+	var v validation.Errors
+	v.OneOf("sortBy", sortBy, models.StockLevelSortKeys)
+	v.Check(page > 0, "page", "must be positive")
+	v.Check(pageSize > 0 && pageSize <= maxPageLimit, "pageSize", "must be between 1 and %d", maxPageLimit)
+	if err := v.Err(); err != nil {
+		return nil, 0, err
+	}
+
 	offset := (page - 1) * pageSize
+	return s.repo.GetStockLevels(ctx, consumptionWindowDays, sortBy, desc, offset, pageSize)
+}
 
-	items, totalCount, err := s.repo.GetLeftOvers(sortBy, offset, pageSize)
-	if err != nil {
+func (s *inventoryService) RecordMovement(ctx context.Context, id int64, kind models.TransactionType, delta decimal.Decimal, unitCost *float64, note string) (models.InventoryItem, error) {
+	if id == 0 {
+		return models.InventoryItem{}, apperr.Validation("id is required")
+	}
+	if !hasQuantityPlaces(delta) {
+		return models.InventoryItem{}, apperr.Validation("delta can have at most %d decimal places", models.QuantityPlaces)
+	}
+	switch kind {
+	case models.TransactionPurchase:
+		if !delta.IsPositive() {
+			return models.InventoryItem{}, apperr.Validation("purchase delta must be positive")
+		}
+	case models.TransactionWaste:
+		if !delta.IsNegative() {
+			return models.InventoryItem{}, apperr.Validation("waste delta must be negative")
+		}
+	case models.TransactionAdjustment:
+		if delta.IsZero() {
+			return models.InventoryItem{}, apperr.Validation("adjustment delta cannot be zero")
+		}
+	default:
+		return models.InventoryItem{}, apperr.Validation("unsupported movement type %q", kind)
+	}
+	if unitCost != nil {
+		if kind != models.TransactionPurchase {
+			return models.InventoryItem{}, apperr.Validation("unit cost can only be given for a purchase")
+		}
+		if *unitCost < 0 {
+			return models.InventoryItem{}, apperr.Validation("unit cost cannot be negative")
+		}
+	}
+
+	return s.repo.ApplyTransaction(ctx, models.InventoryTransaction{
+		IngredientID:   id,
+		QuantityChange: delta,
+		Type:           kind,
+		Reason:         note,
+		UnitCost:       unitCost,
+	})
+}
+
+func (s *inventoryService) GetTransactions(ctx context.Context, id int64, startDate, endDate string, page, pageSize int) ([]models.InventoryTransaction, int, error) {
+	var v validation.Errors
+	v.Check(id != 0, "id", "is required")
+	v.Check(page > 0, "page", "must be positive")
+	v.Check(pageSize > 0 && pageSize <= maxPageLimit, "pageSize", "must be between 1 and %d", maxPageLimit)
+	if err := v.Err(); err != nil {
 		return nil, 0, err
 	}
-	return items, totalCount, nil
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+
+	return s.repo.GetTransactions(ctx, id, startDate, endDate, offset, pageSize)
 }
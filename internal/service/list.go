@@ -0,0 +1,104 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"frappuccino/internal/validation"
+	"frappuccino/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type cursorToken struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+}
+
+func encodeCursor(c models.Cursor) string {
+	data, _ := json.Marshal(cursorToken{Sort: c.Sort, Desc: c.Desc, Value: c.Value, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (models.Cursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return models.Cursor{}, false
+	}
+	var t cursorToken
+	if err := json.Unmarshal(data, &t); err != nil || t.Sort == "" || !validCursorValue(t.Sort, t.Value) {
+		return models.Cursor{}, false
+	}
+	return models.Cursor{Sort: t.Sort, Desc: t.Desc, Value: t.Value, ID: t.ID}, true
+}
+
+// validCursorValue keeps a tampered cursor from reaching the SQL cast.
+func validCursorValue(sort, value string) bool {
+	var err error
+	switch sort {
+	case "id":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "created_at":
+		_, err = time.Parse(time.RFC3339Nano, value)
+	case "price", "total_price", "quantity":
+		_, err = decimal.NewFromString(value)
+	default:
+		return !strings.ContainsRune(value, 0)
+	}
+	return err == nil
+}
+
+func preparePage(v *validation.Errors, page models.PageRequest, cursor string, sortKeys []string, defaultSort string, defaultDesc bool) models.PageRequest {
+	if page.Limit == 0 {
+		page.Limit = defaultPageLimit
+	}
+	v.Check(page.Limit > 0 && page.Limit <= maxPageLimit, "limit", "must be between 1 and %d", maxPageLimit)
+
+	if cursor != "" {
+		after, ok := decodeCursor(cursor)
+		switch {
+		case !ok:
+			v.Add("cursor", "is malformed")
+		case page.Sort != "" && (page.Sort != after.Sort || page.Desc != after.Desc):
+			v.Add("cursor", "was issued for a different sort")
+		default:
+			page.Sort, page.Desc = after.Sort, after.Desc
+			page.After = &after
+		}
+	}
+	if page.Sort == "" {
+		page.Sort, page.Desc = defaultSort, defaultDesc
+	}
+	v.OneOf("sort", page.Sort, sortKeys)
+	return page
+}
+
+func trimPage[T any](rows []T, page models.PageRequest, keyOf func(T) (string, int64)) ([]T, string) {
+	if len(rows) <= page.Limit {
+		return rows, ""
+	}
+	rows = rows[:page.Limit]
+	value, id := keyOf(rows[len(rows)-1])
+	return rows, encodeCursor(models.Cursor{Sort: page.Sort, Desc: page.Desc, Value: value, ID: id})
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
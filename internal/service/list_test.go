@@ -0,0 +1,34 @@
+package service
+
+import (
+	"encoding/base64"
+	"frappuccino/models"
+	"testing"
+)
+
+func TestDecodeCursorChecksValueType(t *testing.T) {
+	tests := []struct {
+		sort, value string
+		ok          bool
+	}{
+		{"id", "42", true},
+		{"id", "abc", false},
+		{"created_at", "2024-05-01T10:00:00.123456Z", true},
+		{"created_at", "yesterday", false},
+		{"price", "4.5", true},
+		{"total_price", "1e3", true},
+		{"quantity", "lots", false},
+		{"name", "Latte", true},
+		{"customer_name", "nul\x00byte", false},
+	}
+	for _, tt := range tests {
+		cursor := encodeCursor(models.Cursor{Sort: tt.sort, Value: tt.value, ID: 7})
+		if _, ok := decodeCursor(cursor); ok != tt.ok {
+			t.Errorf("decodeCursor(sort=%s, value=%q) ok = %v, want %v", tt.sort, tt.value, ok, tt.ok)
+		}
+	}
+
+	if _, ok := decodeCursor(base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":"1","i":"x"}`))); ok {
+		t.Error("decodeCursor accepted a non-numeric id")
+	}
+}
@@ -1,64 +1,169 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"frappuccino/internal/apperr"
 	"frappuccino/internal/repository"
+	"frappuccino/internal/validation"
 	"frappuccino/models"
 )
 
 type MenuService interface {
-	CreateMenuItem(item models.MenuItem) (models.MenuItem, error)
-	GetMenuItems() ([]models.MenuItem, error)
-	GetMenuItem(id int64) (models.MenuItem, error)
-	UpdateMenuItem(id int64, item models.MenuItem) (models.MenuItem, error)
-	DeleteMenuItem(id int64) error
+	CreateMenuItem(ctx context.Context, item models.MenuItem) (models.MenuItem, error)
+	GetMenuItems(ctx context.Context, filter models.MenuFilter, page models.PageRequest, cursor string) ([]models.MenuItem, string, error)
+	GetMenuItem(ctx context.Context, id int64) (models.MenuItem, error)
+	UpdateMenuItem(ctx context.Context, id int64, item models.MenuItem) (models.MenuItem, error)
+	ArchiveMenuItem(ctx context.Context, id, version int64) error
+	RestoreMenuItem(ctx context.Context, id, version int64) (models.MenuItem, error)
+	GetPriceHistory(ctx context.Context, id int64) ([]models.PriceChange, error)
+	GetAvailability(ctx context.Context) ([]models.MenuItemAvailability, error)
 }
 
 type menuService struct {
-	repo repository.MenuRepository
+	repo          repository.MenuRepository
+	modifierRepo  repository.ModifierRepository
+	inventoryRepo repository.InventoryRepository
 }
 
-func NewMenuService(repo repository.MenuRepository) MenuService {
-	return &menuService{repo: repo}
+func NewMenuService(
+	repo repository.MenuRepository,
+	modifierRepo repository.ModifierRepository,
+	inventoryRepo repository.InventoryRepository,
+) MenuService {
+	return &menuService{repo: repo, modifierRepo: modifierRepo, inventoryRepo: inventoryRepo}
 }
 
-func (s *menuService) CreateMenuItem(item models.MenuItem) (models.MenuItem, error) {
-	if item.Name == "" {
-		return models.MenuItem{}, errors.New("name is required")
+func (s *menuService) CreateMenuItem(ctx context.Context, item models.MenuItem) (models.MenuItem, error) {
+	if err := validateMenuItem(ctx, s.inventoryRepo, &item); err != nil {
+		return models.MenuItem{}, err
 	}
-	if item.Price <= 0 {
-		return models.MenuItem{}, errors.New("price must be positive")
+	created, err := s.repo.Create(ctx, item)
+	if err != nil {
+		return models.MenuItem{}, err
 	}
-	return s.repo.Create(item)
+	return s.GetMenuItem(ctx, created.ID)
 }
 
-func (s *menuService) GetMenuItems() ([]models.MenuItem, error) {
-	return s.repo.GetAll()
+func (s *menuService) GetMenuItems(ctx context.Context, filter models.MenuFilter, page models.PageRequest, cursor string) ([]models.MenuItem, string, error) {
+	var v validation.Errors
+	v.Check(filter.MinPrice == nil || *filter.MinPrice >= 0, "min_price", "cannot be negative")
+	v.Check(filter.MinPrice == nil || filter.MaxPrice == nil || *filter.MinPrice <= *filter.MaxPrice,
+		"max_price", "cannot be less than min_price")
+	page = preparePage(&v, page, cursor, models.MenuSortKeys, "id", false)
+	if err := v.Err(); err != nil {
+		return nil, "", err
+	}
+
+	items, err := s.repo.List(ctx, filter, page)
+	if err != nil {
+		return nil, "", err
+	}
+	items, next := trimPage(items, page, func(item models.MenuItem) (string, int64) {
+		switch page.Sort {
+		case "name":
+			return item.Name, item.ID
+		case "price":
+			return formatFloat(item.Price), item.ID
+		}
+		return formatID(item.ID), item.ID
+	})
+
+	portions, err := s.availablePortions(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range items {
+		items[i].AvailablePortions = portionsOf(items[i], portions)
+	}
+	return items, next, nil
+}
+
+func (s *menuService) availablePortions(ctx context.Context) (map[int64]*int, error) {
+	availability, err := s.repo.GetAvailability(ctx)
+	if err != nil {
+		return nil, err
+	}
+	portions := make(map[int64]*int, len(availability))
+	for _, a := range availability {
+		portions[a.ProductID] = a.AvailablePortions
+	}
+	return portions, nil
+}
+
+// portionsOf reports 0 portions for archived items, which cannot be ordered;
+// nil is reserved for items without a recipe.
+func portionsOf(item models.MenuItem, portions map[int64]*int) *int {
+	if item.ArchivedAt != nil {
+		none := 0
+		return &none
+	}
+	return portions[item.ID]
+}
+
+func (s *menuService) GetMenuItem(ctx context.Context, id int64) (models.MenuItem, error) {
+	if id == 0 {
+		return models.MenuItem{}, apperr.Validation("id is required")
+	}
+	item, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+
+	modifiers, err := s.modifierRepo.GetAll(ctx)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+	for _, m := range modifiers {
+		if m.AppliesTo(item) {
+			item.Modifiers = append(item.Modifiers, m)
+		}
+	}
+
+	portions, err := s.availablePortions(ctx)
+	if err != nil {
+		return models.MenuItem{}, err
+	}
+	item.AvailablePortions = portionsOf(item, portions)
+	return item, nil
 }
 
-func (s *menuService) GetMenuItem(id int64) (models.MenuItem, error) {
+func (s *menuService) ArchiveMenuItem(ctx context.Context, id, version int64) error {
 	if id == 0 {
-		return models.MenuItem{}, errors.New("id is required")
+		return apperr.Validation("id is required")
 	}
-	return s.repo.GetByID(id)
+	return s.repo.Archive(ctx, id, version)
 }
 
-func (s *menuService) DeleteMenuItem(id int64) error {
+func (s *menuService) RestoreMenuItem(ctx context.Context, id, version int64) (models.MenuItem, error) {
 	if id == 0 {
-		return errors.New("id is required")
+		return models.MenuItem{}, apperr.Validation("id is required")
 	}
-	return s.repo.Delete(id)
+	if err := s.repo.Restore(ctx, id, version); err != nil {
+		return models.MenuItem{}, err
+	}
+	return s.GetMenuItem(ctx, id)
 }
 
-func (s *menuService) UpdateMenuItem(id int64, item models.MenuItem) (models.MenuItem, error) {
-	if id != item.ID {
-		return models.MenuItem{}, errors.New("ID in path doesn't match ID in body")
+func (s *menuService) UpdateMenuItem(ctx context.Context, id int64, item models.MenuItem) (models.MenuItem, error) {
+	if err := validateMenuItem(ctx, s.inventoryRepo, &item); err != nil {
+		return models.MenuItem{}, err
 	}
-	if item.Name == "" {
-		return models.MenuItem{}, errors.New("name is required")
+	if _, err := s.repo.Update(ctx, id, item); err != nil {
+		return models.MenuItem{}, err
 	}
-	if item.Price <= 0 {
-		return models.MenuItem{}, errors.New("price must be positive")
+	return s.GetMenuItem(ctx, id)
+}
+
+func (s *menuService) GetPriceHistory(ctx context.Context, id int64) ([]models.PriceChange, error) {
+	if id == 0 {
+		return nil, apperr.Validation("id is required")
 	}
-	return s.repo.Update(id, item)
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPriceHistory(ctx, id)
+}
+
+func (s *menuService) GetAvailability(ctx context.Context) ([]models.MenuItemAvailability, error) {
+	return s.repo.GetAvailability(ctx)
 }
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"frappuccino/internal/apperr"
+	"frappuccino/internal/repository"
+	"frappuccino/models"
+)
+
+type ModifierService interface {
+	CreateModifier(ctx context.Context, m models.Modifier) (models.Modifier, error)
+	GetModifiers(ctx context.Context) ([]models.Modifier, error)
+	GetModifier(ctx context.Context, id int64) (models.Modifier, error)
+	UpdateModifier(ctx context.Context, id int64, m models.Modifier) (models.Modifier, error)
+	DeleteModifier(ctx context.Context, id int64) error
+}
+
+type modifierService struct {
+	repo          repository.ModifierRepository
+	menuRepo      repository.MenuRepository
+	inventoryRepo repository.InventoryRepository
+}
+
+func NewModifierService(
+	repo repository.ModifierRepository,
+	menuRepo repository.MenuRepository,
+	inventoryRepo repository.InventoryRepository,
+) ModifierService {
+	return &modifierService{repo: repo, menuRepo: menuRepo, inventoryRepo: inventoryRepo}
+}
+
+func (s *modifierService) CreateModifier(ctx context.Context, m models.Modifier) (models.Modifier, error) {
+	if err := validateModifier(ctx, s.menuRepo, s.inventoryRepo, &m); err != nil {
+		return models.Modifier{}, err
+	}
+	return s.repo.Create(ctx, m)
+}
+
+func (s *modifierService) GetModifiers(ctx context.Context) ([]models.Modifier, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *modifierService) GetModifier(ctx context.Context, id int64) (models.Modifier, error) {
+	if id == 0 {
+		return models.Modifier{}, apperr.Validation("id is required")
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *modifierService) UpdateModifier(ctx context.Context, id int64, m models.Modifier) (models.Modifier, error) {
+	if id == 0 {
+		return models.Modifier{}, apperr.Validation("id is required")
+	}
+	if err := validateModifier(ctx, s.menuRepo, s.inventoryRepo, &m); err != nil {
+		return models.Modifier{}, err
+	}
+	return s.repo.Update(ctx, id, m)
+}
+
+func (s *modifierService) DeleteModifier(ctx context.Context, id int64) error {
+	if id == 0 {
+		return apperr.Validation("id is required")
+	}
+	return s.repo.Delete(ctx, id)
+}
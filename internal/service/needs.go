@@ -0,0 +1,63 @@
+package service
+
+import (
+	"frappuccino/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// ingredientNeed is kept in the base unit of its kind so amounts in different units add up.
+type ingredientNeed struct {
+	amount decimal.Decimal
+	unit   string
+}
+
+type ingredientNeeds map[int64]ingredientNeed
+
+func (n ingredientNeeds) add(id int64, quantity decimal.Decimal, unit string) error {
+	base := models.BaseUnit(unit)
+	amount, err := models.ConvertQuantity(quantity, unit, base)
+	if err != nil {
+		return err
+	}
+	need, ok := n[id]
+	if ok && need.unit != base {
+		return &models.UnitMismatchError{From: unit, To: need.unit}
+	}
+	n[id] = ingredientNeed{amount: need.amount.Add(amount), unit: base}
+	return nil
+}
+
+func (n ingredientNeeds) addTimes(other ingredientNeeds, times int) error {
+	for id, need := range other {
+		if err := n.add(id, need.amount.Mul(decimal.NewFromInt(int64(times))), need.unit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n ingredientNeeds) uses() []models.IngredientUse {
+	uses := make([]models.IngredientUse, 0, len(n))
+	for _, id := range sortedIDs(n) {
+		uses = append(uses, models.IngredientUse{IngredientID: id, Quantity: n[id].amount, Unit: n[id].unit})
+	}
+	return uses
+}
+
+func needsOf(uses []models.IngredientUse) ingredientNeeds {
+	n := make(ingredientNeeds, len(uses))
+	for _, u := range uses {
+		n[u.IngredientID] = ingredientNeed{amount: u.Quantity, unit: u.Unit}
+	}
+	return n
+}
+
+// in rounds up to models.QuantityPlaces, the precision stock is kept to.
+func (need ingredientNeed) in(unit string) (decimal.Decimal, error) {
+	amount, err := models.ConvertQuantity(need.amount, need.unit, unit)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return amount.RoundUp(models.QuantityPlaces), nil
+}
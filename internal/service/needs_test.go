@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"frappuccino/models"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func TestIngredientNeedsAddMixedUnits(t *testing.T) {
+	type addition struct {
+		quantity string
+		unit     string
+	}
+	tests := []struct {
+		name      string
+		additions []addition
+		want      string
+		wantUnit  string
+	}{
+		{"single unit", []addition{{"18", "g"}}, "18", "g"},
+		{"kg and g", []addition{{"0.5", "kg"}, {"7.5", "g"}}, "507.5", "g"},
+		{"liter and ml", []addition{{"0.25", "liter"}, {"30", "ml"}}, "280", "ml"},
+		{"pieces", []addition{{"1", "unit"}, {"2", "unit"}}, "3", "unit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needs := make(ingredientNeeds)
+			for _, a := range tt.additions {
+				if err := needs.add(1, dec(a.quantity), a.unit); err != nil {
+					t.Fatalf("add(%s %s) = %v", a.quantity, a.unit, err)
+				}
+			}
+			need := needs[1]
+			if !need.amount.Equal(dec(tt.want)) || need.unit != tt.wantUnit {
+				t.Errorf("need = %s %s, want %s %s", need.amount, need.unit, tt.want, tt.wantUnit)
+			}
+		})
+	}
+}
+
+func TestIngredientNeedsAddKindMismatch(t *testing.T) {
+	needs := make(ingredientNeeds)
+	if err := needs.add(1, dec("200"), "ml"); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch *models.UnitMismatchError
+	if err := needs.add(1, dec("10"), "g"); !errors.As(err, &mismatch) {
+		t.Errorf("adding g to a need in ml = %v, want a UnitMismatchError", err)
+	}
+	if !needs[1].amount.Equal(dec("200")) {
+		t.Errorf("need changed to %s after a failed add", needs[1].amount)
+	}
+}
+
+func TestIngredientNeedsAddTimes(t *testing.T) {
+	line := make(ingredientNeeds)
+	line.add(1, dec("18"), "g")
+	line.add(2, dec("0.2"), "liter")
+
+	order := make(ingredientNeeds)
+	if err := order.addTimes(line, 3); err != nil {
+		t.Fatal(err)
+	}
+	if !order[1].amount.Equal(dec("54")) || !order[2].amount.Equal(dec("600")) || order[2].unit != "ml" {
+		t.Errorf("needs = %v, want 54 g and 600 ml", order)
+	}
+}
+
+func TestIngredientNeedIn(t *testing.T) {
+	tests := []struct {
+		name    string
+		need    ingredientNeed
+		unit    string
+		want    string
+		wantErr bool
+	}{
+		{"same unit", ingredientNeed{dec("18"), "g"}, "g", "18", false},
+		{"exact conversion", ingredientNeed{dec("250"), "ml"}, "liter", "0.25", false},
+		{"rounds up to QuantityPlaces", ingredientNeed{dec("0.5"), "g"}, "kg", "0.001", false},
+		{"rounds up, never down", ingredientNeed{dec("1001"), "ml"}, "liter", "1.001", false},
+		{"rounds up a fourth decimal place", ingredientNeed{dec("1234.5"), "g"}, "kg", "1.235", false},
+		{"different kind", ingredientNeed{dec("10"), "ml"}, "g", "0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.need.in(tt.unit)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("in(%s) error = %v, want error %v", tt.unit, err, tt.wantErr)
+			}
+			if !got.Equal(dec(tt.want)) {
+				t.Errorf("in(%s) = %s, want %s", tt.unit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRoundTripThroughUses(t *testing.T) {
+	needs := make(ingredientNeeds)
+	needs.add(2, dec("0.3"), "liter")
+	needs.add(1, dec("7.5"), "g")
+
+	uses := needs.uses()
+	if len(uses) != 2 || uses[0].IngredientID != 1 || uses[1].IngredientID != 2 {
+		t.Fatalf("uses() = %v, want ingredients 1 and 2 in ID order", uses)
+	}
+	back := needsOf(uses)
+	for id, need := range needs {
+		if !back[id].amount.Equal(need.amount) || back[id].unit != need.unit {
+			t.Errorf("needsOf(uses())[%d] = %v, want %v", id, back[id], need)
+		}
+	}
+}
@@ -5,25 +5,60 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"frappuccino/internal/apperr"
 	"frappuccino/internal/repository"
+	"frappuccino/internal/validation"
 	"frappuccino/models"
 	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
 )
 
 type OrderService interface {
-	CreateOrder(order models.Order) (models.Order, error)
-	GetOrders() ([]models.Order, error)
-	GetOrder(id int64) (models.Order, error)
-	GetNumberOfOrderedItems(startDate, endDate string) (map[string]int, error)
-	UpdateOrder(id int64, order models.Order) (models.Order, error)
-	DeleteOrder(id int64) error
-	CloseOrder(id int64) (models.Order, error)
+	CreateOrder(ctx context.Context, order models.Order, idempotent *IdempotentResponse) (models.Order, error)
+	GetOrders(ctx context.Context, filter models.OrderFilter, page models.PageRequest, cursor string) ([]models.Order, string, error)
+	GetOrder(ctx context.Context, id int64) (models.Order, error)
+	GetNumberOfOrderedItems(ctx context.Context, startDate, endDate string) (map[string]int, error)
+	UpdateOrder(ctx context.Context, id int64, order models.Order) (models.Order, error)
+	AddOrderItem(ctx context.Context, orderID int64, item models.OrderItem, version int64) (models.Order, error)
+	UpdateOrderItem(ctx context.Context, orderID, itemID int64, quantity int, version int64) (models.Order, error)
+	RemoveOrderItem(ctx context.Context, orderID, itemID, version int64) (models.Order, error)
+	DeleteOrder(ctx context.Context, id, version int64) error
+	StartOrder(ctx context.Context, id int64) (models.Order, error)
+	CloseOrder(ctx context.Context, id int64) (models.Order, error)
+	CancelOrder(ctx context.Context, id int64) (models.Order, error)
+}
+
+type InsufficientStockError struct {
+	Shortages []models.IngredientShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	parts := make([]string, 0, len(e.Shortages))
+	for _, sh := range e.Shortages {
+		parts = append(parts, fmt.Sprintf("%s: need %s%s, have %s%s", sh.Name, sh.Required, sh.Unit, sh.Available, sh.Unit))
+	}
+	return "not enough inventory (" + strings.Join(parts, "; ") + ")"
+}
+
+type TransitionError struct {
+	From models.OrderStatus
+	To   models.OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order cannot move from %s to %s", e.From, e.To)
 }
 
 type orderService struct {
 	orderRepo     repository.OrderRepository
 	menuRepo      repository.MenuRepository
 	inventoryRepo repository.InventoryRepository
+	modifierRepo  repository.ModifierRepository
+	idempotency   repository.IdempotencyRepository
 	db            *sql.DB
 }
 
@@ -31,68 +66,52 @@ func NewOrderService(
 	orderRepo repository.OrderRepository,
 	menuRepo repository.MenuRepository,
 	inventoryRepo repository.InventoryRepository,
+	modifierRepo repository.ModifierRepository,
+	idempotencyRepo repository.IdempotencyRepository,
 	db *sql.DB,
 ) OrderService {
 	return &orderService{
 		orderRepo:     orderRepo,
 		menuRepo:      menuRepo,
 		inventoryRepo: inventoryRepo,
+		modifierRepo:  modifierRepo,
+		idempotency:   idempotencyRepo,
 		db:            db,
 	}
 }
 
-func (s *orderService) CreateOrder(order models.Order) (models.Order, error) {
-	if order.CustomerName == "" {
-		return models.Order{}, errors.New("customer_name is required")
-	}
-	if len(order.Items) == 0 {
-		return models.Order{}, errors.New("order must contain at least one item")
+// CreateOrder claims idempotent's key and stores the response in the order's transaction.
+func (s *orderService) CreateOrder(ctx context.Context, order models.Order, idempotent *IdempotentResponse) (models.Order, error) {
+	if err := validateOrder(ctx, s.menuRepo, order); err != nil {
+		return models.Order{}, err
 	}
 
 	menuCache := make(map[int64]models.MenuItem)
+	modifierCache := make(map[int64]models.Modifier)
+	needs := make(ingredientNeeds)
+	var total float64
 
-	for _, item := range order.Items {
-		if item.Quantity <= 0 {
-			return models.Order{}, errors.New("quantity must be positive")
+	for i, item := range order.Items {
+		line, ingredients, err := s.priceLine(ctx, item, menuCache, modifierCache)
+		if err != nil {
+			return models.Order{}, err
 		}
 
-		menuItem, ok := menuCache[item.ProductID]
-		if !ok {
-			var err error
-			menuItem, err = s.menuRepo.GetByID(item.ProductID)
-			if err != nil {
-				log.Print("Invalid product ID", "product_id", item.ProductID, "error", err)
-				return models.Order{}, fmt.Errorf("product ID '%s' not found in menu", item.ProductID)
-			}
-			menuCache[item.ProductID] = menuItem
-		}
+		order.Items[i] = line
+		total += line.UnitPrice * float64(line.Quantity)
 
-		for _, ingredient := range menuItem.Ingredients {
-			invItem, err := s.inventoryRepo.GetByID(ingredient.IngredientID)
-			if err != nil {
-				log.Printf("Inventory item not found", "ingredient_id", ingredient.IngredientID, "error", err)
-				return models.Order{}, fmt.Errorf("ingredient '%s' not available", ingredient.IngredientID)
-			}
-			needed := ingredient.Quantity * (item.Quantity)
-			if invItem.Quantity < needed {
-				return models.Order{}, fmt.Errorf(
-					"not enough %s. Need %.2f%s, have %.2f%s",
-					invItem.Name,
-					needed,
-					invItem.Unit,
-					invItem.Quantity,
-					invItem.Unit,
-				)
-			}
+		if err := needs.addTimes(ingredients, line.Quantity); err != nil {
+			return models.Order{}, apperr.Conflict("%s: %v", line.ProductName, err)
 		}
 	}
 
-	order.Status = "open"
+	order.TotalPrice = roundPrice(total)
+	order.Status = models.StatusPending
 
-	tx, err := s.db.BeginTx(context.Background(), nil)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		log.Print("Failed to begin transaction", "error", err)
-		return models.Order{}, errors.New("failed to start transaction")
+		return models.Order{}, fmt.Errorf("failed to start transaction: %w", err)
 	}
 
 	rollback := func(err error) (models.Order, error) {
@@ -102,91 +121,326 @@ func (s *orderService) CreateOrder(order models.Order) (models.Order, error) {
 		return models.Order{}, err
 	}
 
-	for _, item := range order.Items {
-		menuItem := menuCache[item.ProductID]
-		for _, ingredient := range menuItem.Ingredients {
-			invItem, err := s.inventoryRepo.GetByID(ingredient.IngredientID)
-			if err != nil {
-				return rollback(fmt.Errorf("ingredient '%s' not available", ingredient.IngredientID))
-			}
-			needed := ingredient.Quantity * item.Quantity
-			invItem.Quantity -= needed
-			updatedInv, err := s.inventoryRepo.UpdateTx(tx, invItem)
-			if err != nil {
-				log.Print("Failed to update inventory", "error", err)
-				return rollback(fmt.Errorf("failed to update inventory: %v", err))
-			}
-			_ = updatedInv
+	if idempotent != nil {
+		claimed, err := s.idempotency.ClaimTx(ctx, tx, idempotent.Key, idempotent.RequestHash)
+		if err != nil {
+			log.Print("Failed to claim idempotency key", "key", idempotent.Key, "error", err)
+			return rollback(err)
+		}
+		if !claimed {
+			return rollback(ErrIdempotencyKeyTaken)
 		}
 	}
 
-	createdOrder, err := s.orderRepo.CreateTx(tx, order)
+	createdOrder, err := s.orderRepo.CreateTx(ctx, tx, order)
 	if err != nil {
 		log.Print("Failed to save order", "error", err)
-		return rollback(errors.New("failed to save order"))
+		return rollback(fmt.Errorf("failed to save order: %w", err))
+	}
+
+	if err := s.reserveIngredients(ctx, tx, needs, createdOrder.ID); err != nil {
+		return rollback(err)
+	}
+
+	if idempotent != nil {
+		body, err := idempotent.Render(createdOrder)
+		if err != nil {
+			return rollback(err)
+		}
+		if err := s.idempotency.CompleteTx(ctx, tx, idempotent.Key, idempotent.StatusCode, body); err != nil {
+			log.Print("Failed to store idempotent response", "key", idempotent.Key, "error", err)
+			return rollback(err)
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
 		log.Print("Failed to commit transaction", "error", err)
-		return models.Order{}, errors.New("failed to commit transaction")
+		return models.Order{}, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	return createdOrder, nil
 }
 
-func (s *orderService) GetOrders() ([]models.Order, error) {
-	return s.orderRepo.GetAll()
+// priceLine snapshots the current price and consumption of a new order line.
+func (s *orderService) priceLine(
+	ctx context.Context,
+	item models.OrderItem,
+	menuCache map[int64]models.MenuItem,
+	modifierCache map[int64]models.Modifier,
+) (models.OrderItem, ingredientNeeds, error) {
+	menuItem, ok := menuCache[item.ProductID]
+	if !ok {
+		var err error
+		menuItem, err = s.menuRepo.GetByID(ctx, item.ProductID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return models.OrderItem{}, nil, apperr.Validation("product ID '%d' not found in menu", item.ProductID)
+			}
+			log.Print("Failed to load menu item", "product_id", item.ProductID, "error", err)
+			return models.OrderItem{}, nil, err
+		}
+		menuCache[item.ProductID] = menuItem
+	}
+	if menuItem.ArchivedAt != nil {
+		return models.OrderItem{}, nil, apperr.Validation("%s is no longer on the menu", menuItem.Name)
+	}
+
+	customization, unitPrice, ingredients, err := s.customizeLine(ctx, menuItem, item.Customization, modifierCache)
+	if err != nil {
+		return models.OrderItem{}, nil, err
+	}
+	item.ProductName = menuItem.Name
+	item.UnitPrice = unitPrice
+	item.Customization = customization
+	item.Consumption = ingredients.uses()
+	return item, ingredients, nil
+}
+
+func (s *orderService) GetOrders(ctx context.Context, filter models.OrderFilter, page models.PageRequest, cursor string) ([]models.Order, string, error) {
+	var v validation.Errors
+	if filter.Status != "" {
+		v.OneOf("status", string(filter.Status), models.OrderStatuses)
+	}
+	v.Check(filter.From.IsZero() || filter.To.IsZero() || filter.From.Before(filter.To), "to", "must be after from")
+	page = preparePage(&v, page, cursor, models.OrderSortKeys, "created_at", true)
+	if err := v.Err(); err != nil {
+		return nil, "", err
+	}
+
+	orders, err := s.orderRepo.List(ctx, filter, page)
+	if err != nil {
+		return nil, "", err
+	}
+	orders, next := trimPage(orders, page, func(o models.Order) (string, int64) {
+		switch page.Sort {
+		case "created_at":
+			return formatTime(o.CreatedAt), o.ID
+		case "total_price":
+			return formatFloat(o.TotalPrice), o.ID
+		case "customer_name":
+			return o.CustomerName, o.ID
+		}
+		return formatID(o.ID), o.ID
+	})
+	return orders, next, nil
 }
 
-func (s *orderService) GetOrder(id int64) (models.Order, error) {
+func (s *orderService) GetOrder(ctx context.Context, id int64) (models.Order, error) {
 	if id == 0 {
-		return models.Order{}, errors.New("id is required")
+		return models.Order{}, apperr.Validation("id is required")
 	}
-	return s.orderRepo.GetByID(id)
+	return s.orderRepo.GetByID(ctx, id)
 }
 
-func (s *orderService) UpdateOrder(id int64, order models.Order) (models.Order, error) {
+func (s *orderService) DeleteOrder(ctx context.Context, id, version int64) error {
 	if id == 0 {
-		return models.Order{}, errors.New("id is required")
+		return apperr.Validation("id is required")
 	}
 
-	existingOrder, err := s.orderRepo.GetByID(id)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return models.Order{}, err
+		log.Print("Failed to begin transaction", "error", err)
+		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	order.ID = existingOrder.ID
-	order.CreatedAt = existingOrder.CreatedAt
-	order.Status = existingOrder.Status
+	order, err := s.orderRepo.GetForUpdateTx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := repository.CheckVersion(version, order.Version); err != nil {
+		return err
+	}
+	if order.Status != models.StatusClosed && order.Status != models.StatusCancelled {
+		if err := s.restoreInventory(ctx, tx, id); err != nil {
+			return err
+		}
+	}
 
-	return s.orderRepo.Update(id, order)
-}
+	if err := s.orderRepo.DeleteTx(ctx, tx, id); err != nil {
+		log.Print("Failed to delete order", "id", id, "error", err)
+		return err
+	}
 
-func (s *orderService) DeleteOrder(id int64) error {
-	if id == 0 {
-		return errors.New("id is required")
+	if err := tx.Commit(); err != nil {
+		log.Print("Failed to commit transaction", "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
-	return s.orderRepo.Delete(id)
+	return nil
+}
+
+func (s *orderService) StartOrder(ctx context.Context, id int64) (models.Order, error) {
+	return s.transition(ctx, id, models.StatusProcessing)
+}
+
+func (s *orderService) CloseOrder(ctx context.Context, id int64) (models.Order, error) {
+	return s.transition(ctx, id, models.StatusClosed)
+}
+
+func (s *orderService) CancelOrder(ctx context.Context, id int64) (models.Order, error) {
+	return s.transition(ctx, id, models.StatusCancelled)
 }
 
-func (s *orderService) CloseOrder(id int64) (models.Order, error) {
+func (s *orderService) transition(ctx context.Context, id int64, next models.OrderStatus) (models.Order, error) {
 	if id == 0 {
-		return models.Order{}, errors.New("id is required")
+		return models.Order{}, apperr.Validation("id is required")
 	}
 
-	order, err := s.orderRepo.GetByID(id)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
+		log.Print("Failed to begin transaction", "error", err)
+		return models.Order{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := s.orderRepo.GetStatusForUpdateTx(ctx, tx, id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if !current.CanTransitionTo(next) {
+		transitionErr := &TransitionError{From: current, To: next}
+		return models.Order{}, apperr.Wrap(apperr.CodeConflict, transitionErr).WithDetails(transitionErr)
+	}
+
+	if err := s.orderRepo.SetStatusTx(ctx, tx, id, next); err != nil {
+		log.Print("Failed to update order status", "id", id, "error", err)
 		return models.Order{}, err
 	}
 
-	if order.Status == "closed" {
-		return models.Order{}, errors.New("order is already closed")
+	if next == models.StatusCancelled {
+		if err := s.restoreInventory(ctx, tx, id); err != nil {
+			return models.Order{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Print("Failed to commit transaction", "error", err)
+		return models.Order{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.orderRepo.GetByID(ctx, id)
+}
+
+// reserveIngredients locks the inventory rows before checking them, so two
+// concurrent orders can never both take the last portion.
+func (s *orderService) reserveIngredients(ctx context.Context, tx *sql.Tx, needs ingredientNeeds, orderID int64) error {
+	ids := sortedIDs(needs)
+	stock, err := s.inventoryRepo.GetForUpdateTx(ctx, tx, ids)
+	if err != nil {
+		log.Print("Failed to lock inventory", "error", err)
+		return fmt.Errorf("failed to update inventory: %w", err)
+	}
+
+	var held map[int64]decimal.Decimal
+	changes := make(map[int64]decimal.Decimal, len(ids))
+	var shortages []models.IngredientShortage
+	for _, ingredientID := range ids {
+		need := needs[ingredientID]
+		if need.amount.IsZero() {
+			continue
+		}
+		item, ok := stock[ingredientID]
+		if !ok {
+			// A deleted ingredient has nothing left to return to.
+			if need.amount.IsNegative() {
+				continue
+			}
+			return apperr.Conflict("ingredient '%d' not available", ingredientID)
+		}
+
+		if need.amount.IsNegative() {
+			quantity, err := ingredientNeed{amount: need.amount.Neg(), unit: need.unit}.in(item.Unit)
+			if err != nil {
+				return apperr.Conflict("%s is stocked in %s: %v", item.Name, item.Unit, err)
+			}
+			if held == nil {
+				if held, err = s.inventoryRepo.GetOrderConsumptionTx(ctx, tx, orderID); err != nil {
+					log.Print("Failed to load ingredient usage", "order_id", orderID, "error", err)
+					return err
+				}
+			}
+			changes[ingredientID] = decimal.Min(quantity, held[ingredientID])
+			continue
+		}
+
+		quantity, err := need.in(item.Unit)
+		if err != nil {
+			return apperr.Conflict("%s is stocked in %s: %v", item.Name, item.Unit, err)
+		}
+		changes[ingredientID] = quantity.Neg()
+		if item.Quantity.LessThan(quantity) {
+			shortages = append(shortages, models.IngredientShortage{
+				IngredientID: ingredientID,
+				Name:         item.Name,
+				Unit:         item.Unit,
+				Required:     quantity,
+				Available:    item.Quantity,
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		stockErr := &InsufficientStockError{Shortages: shortages}
+		return apperr.Wrap(apperr.CodeInsufficientStock, stockErr).WithDetails(shortages)
+	}
+
+	for _, ingredientID := range ids {
+		change := changes[ingredientID]
+		if change.IsZero() {
+			continue
+		}
+		transactionType := models.TransactionOrderConsumption
+		if change.IsPositive() {
+			transactionType = models.TransactionOrderReturn
+		}
+		err := s.inventoryRepo.ApplyTransactionTx(ctx, tx, models.InventoryTransaction{
+			IngredientID:   ingredientID,
+			QuantityChange: change,
+			Type:           transactionType,
+			OrderID:        orderID,
+		})
+		if err != nil {
+			log.Print("Failed to update inventory", "error", err)
+			return fmt.Errorf("failed to update inventory: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *orderService) restoreInventory(ctx context.Context, tx *sql.Tx, orderID int64) error {
+	usage, err := s.inventoryRepo.GetOrderConsumptionTx(ctx, tx, orderID)
+	if err != nil {
+		log.Print("Failed to load ingredient usage", "order_id", orderID, "error", err)
+		return err
 	}
 
-	order.Status = "closed"
-	return s.orderRepo.Update(id, order)
+	for _, ingredientID := range sortedIDs(usage) {
+		err := s.inventoryRepo.ApplyTransactionTx(ctx, tx, models.InventoryTransaction{
+			IngredientID:   ingredientID,
+			QuantityChange: usage[ingredientID],
+			Type:           models.TransactionOrderReturn,
+			OrderID:        orderID,
+		})
+		if err != nil {
+			log.Print("Failed to restore inventory", "ingredient_id", ingredientID, "error", err)
+			return fmt.Errorf("failed to restore inventory: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *orderService) GetNumberOfOrderedItems(ctx context.Context, startDate, endDate string) (map[string]int, error) {
+	return s.orderRepo.GetNumberOfOrderedItems(ctx, startDate, endDate)
 }
 
-func (s *orderService) GetNumberOfOrderedItems(startDate, endDate string) (map[string]int, error) {
-	return s.orderRepo.GetNumberOfOrderedItems(startDate, endDate)
+func roundPrice(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func sortedIDs[V any](m map[int64]V) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
 }
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"frappuccino/internal/apperr"
+	"frappuccino/internal/repository"
+	"frappuccino/internal/validation"
+	"frappuccino/models"
+	"log"
+)
+
+func (s *orderService) UpdateOrder(ctx context.Context, id int64, order models.Order) (models.Order, error) {
+	if id == 0 {
+		return models.Order{}, apperr.Validation("id is required")
+	}
+	if err := validateOrder(ctx, s.menuRepo, order); err != nil {
+		return models.Order{}, err
+	}
+
+	return s.editOrder(ctx, id, order.Version, func(current models.Order) (models.Order, error) {
+		current.CustomerName = order.CustomerName
+		current.Items = matchLines(current.Items, order.Items)
+		return current, nil
+	})
+}
+
+func (s *orderService) AddOrderItem(ctx context.Context, orderID int64, item models.OrderItem, version int64) (models.Order, error) {
+	if orderID == 0 {
+		return models.Order{}, apperr.Validation("id is required")
+	}
+	var v validation.Errors
+	validateOrderItem(&v, "", item)
+	if err := v.Err(); err != nil {
+		return models.Order{}, err
+	}
+
+	item.ID = 0
+	return s.editOrder(ctx, orderID, version, func(current models.Order) (models.Order, error) {
+		current.Items = append(current.Items, item)
+		return current, nil
+	})
+}
+
+func (s *orderService) UpdateOrderItem(ctx context.Context, orderID, itemID int64, quantity int, version int64) (models.Order, error) {
+	if orderID == 0 || itemID == 0 {
+		return models.Order{}, apperr.Validation("id is required")
+	}
+	var v validation.Errors
+	v.Check(quantity > 0, "quantity", "must be positive")
+	if err := v.Err(); err != nil {
+		return models.Order{}, err
+	}
+
+	return s.editOrder(ctx, orderID, version, func(current models.Order) (models.Order, error) {
+		i, err := findLine(current, itemID)
+		if err != nil {
+			return models.Order{}, err
+		}
+		current.Items[i].Quantity = quantity
+		return current, nil
+	})
+}
+
+func (s *orderService) RemoveOrderItem(ctx context.Context, orderID, itemID, version int64) (models.Order, error) {
+	if orderID == 0 || itemID == 0 {
+		return models.Order{}, apperr.Validation("id is required")
+	}
+
+	return s.editOrder(ctx, orderID, version, func(current models.Order) (models.Order, error) {
+		i, err := findLine(current, itemID)
+		if err != nil {
+			return models.Order{}, err
+		}
+		if len(current.Items) == 1 {
+			return models.Order{}, apperr.Conflict("cannot remove the last item of order '%d'; cancel the order instead", orderID)
+		}
+		current.Items = append(current.Items[:i], current.Items[i+1:]...)
+		return current, nil
+	})
+}
+
+func (s *orderService) editOrder(ctx context.Context, id, version int64, edit func(current models.Order) (models.Order, error)) (models.Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Print("Failed to begin transaction", "error", err)
+		return models.Order{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := s.orderRepo.GetForUpdateTx(ctx, tx, id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if err := repository.CheckVersion(version, current.Version); err != nil {
+		return models.Order{}, err
+	}
+	if current.Status == models.StatusClosed || current.Status == models.StatusCancelled {
+		return models.Order{}, apperr.Conflict("order '%d' is %s and cannot be edited", id, current.Status)
+	}
+
+	// edit may reuse the backing array of current.Items.
+	existing := make(map[int64]models.OrderItem, len(current.Items))
+	for _, item := range current.Items {
+		existing[item.ID] = item
+	}
+	edited, err := edit(current)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	menuCache := make(map[int64]models.MenuItem)
+	modifierCache := make(map[int64]models.Modifier)
+	needs := make(ingredientNeeds)
+	kept := make(map[int64]bool, len(edited.Items))
+	var total float64
+
+	// Existing lines use what they consumed when added, not the current recipes.
+	adjust := func(item models.OrderItem, delta int) error {
+		if delta == 0 {
+			return nil
+		}
+		if err := needs.addTimes(needsOf(item.Consumption), delta); err != nil {
+			return apperr.Conflict("%s: %v", item.ProductName, err)
+		}
+		return nil
+	}
+
+	for i, item := range edited.Items {
+		if item.ID == 0 {
+			line, ingredients, err := s.priceLine(ctx, item, menuCache, modifierCache)
+			if err != nil {
+				return models.Order{}, err
+			}
+			edited.Items[i] = line
+			if err := needs.addTimes(ingredients, line.Quantity); err != nil {
+				return models.Order{}, apperr.Conflict("%s: %v", line.ProductName, err)
+			}
+		} else {
+			kept[item.ID] = true
+			if err := adjust(existing[item.ID], item.Quantity-existing[item.ID].Quantity); err != nil {
+				return models.Order{}, err
+			}
+		}
+		total += edited.Items[i].UnitPrice * float64(edited.Items[i].Quantity)
+	}
+	removed := make([]int64, 0, len(existing))
+	for _, itemID := range sortedIDs(existing) {
+		if !kept[itemID] {
+			removed = append(removed, itemID)
+			if err := adjust(existing[itemID], -existing[itemID].Quantity); err != nil {
+				return models.Order{}, err
+			}
+		}
+	}
+	edited.TotalPrice = roundPrice(total)
+
+	if err := s.reserveIngredients(ctx, tx, needs, id); err != nil {
+		return models.Order{}, err
+	}
+
+	for _, itemID := range removed {
+		if err := s.orderRepo.DeleteItemTx(ctx, tx, itemID); err != nil {
+			log.Print("Failed to remove order item", "id", itemID, "error", err)
+			return models.Order{}, err
+		}
+	}
+	for _, item := range edited.Items {
+		var err error
+		switch {
+		case item.ID == 0:
+			err = s.orderRepo.AddItemTx(ctx, tx, id, item)
+		case item.Quantity != existing[item.ID].Quantity:
+			err = s.orderRepo.SetItemQuantityTx(ctx, tx, item.ID, item.Quantity)
+		}
+		if err != nil {
+			log.Print("Failed to save order item", "order_id", id, "error", err)
+			return models.Order{}, err
+		}
+	}
+	if err := s.orderRepo.UpdateTx(ctx, tx, edited); err != nil {
+		log.Print("Failed to update order", "id", id, "error", err)
+		return models.Order{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Print("Failed to commit transaction", "error", err)
+		return models.Order{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.orderRepo.GetByID(ctx, id)
+}
+
+// matchLines keeps the ID and price of existing lines a requested line matches.
+func matchLines(existing, requested []models.OrderItem) []models.OrderItem {
+	used := make([]bool, len(existing))
+	lines := make([]models.OrderItem, 0, len(requested))
+	for _, item := range requested {
+		item.ID = 0
+		for j, old := range existing {
+			if !used[j] && sameLine(old, item) {
+				used[j] = true
+				old.Quantity = item.Quantity
+				item = old
+				break
+			}
+		}
+		lines = append(lines, item)
+	}
+	return lines
+}
+
+func sameLine(existing, requested models.OrderItem) bool {
+	if existing.ProductID != requested.ProductID ||
+		len(existing.Customization.Modifiers) != len(requested.Customization.Modifiers) {
+		return false
+	}
+	for i, m := range requested.Customization.Modifiers {
+		quantity := m.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+		applied := existing.Customization.Modifiers[i]
+		if applied.ModifierID != m.ModifierID || applied.Quantity != quantity {
+			return false
+		}
+	}
+	return true
+}
+
+func findLine(order models.Order, itemID int64) (int, error) {
+	for i, item := range order.Items {
+		if item.ID == itemID {
+			return i, nil
+		}
+	}
+	return 0, apperr.NotFound("order '%d' has no item '%d'", order.ID, itemID)
+}
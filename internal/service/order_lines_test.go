@@ -0,0 +1,70 @@
+package service
+
+import (
+	"frappuccino/models"
+	"testing"
+)
+
+func line(id, productID int64, quantity int, modifiers ...models.AppliedModifier) models.OrderItem {
+	return models.OrderItem{
+		ID:            id,
+		ProductID:     productID,
+		Quantity:      quantity,
+		UnitPrice:     float64(productID),
+		Customization: models.Customization{Modifiers: modifiers},
+	}
+}
+
+func TestSameLine(t *testing.T) {
+	oat := models.AppliedModifier{ModifierID: 7, Quantity: 1}
+	doubleShot := models.AppliedModifier{ModifierID: 8, Quantity: 2}
+	tests := []struct {
+		name      string
+		existing  models.OrderItem
+		requested models.OrderItem
+		want      bool
+	}{
+		{"same plain product", line(1, 3, 1), line(0, 3, 2), true},
+		{"other product", line(1, 3, 1), line(0, 4, 1), false},
+		{"same modifiers", line(1, 3, 1, oat, doubleShot), line(0, 3, 1, oat, doubleShot), true},
+		{"missing quantity means once", line(1, 3, 1, oat), line(0, 3, 1, models.AppliedModifier{ModifierID: 7}), true},
+		{"other modifier quantity", line(1, 3, 1, doubleShot), line(0, 3, 1, models.AppliedModifier{ModifierID: 8, Quantity: 1}), false},
+		{"modifier added", line(1, 3, 1), line(0, 3, 1, oat), false},
+		{"modifier removed", line(1, 3, 1, oat), line(0, 3, 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameLine(tt.existing, tt.requested); got != tt.want {
+				t.Errorf("sameLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchLines(t *testing.T) {
+	oat := models.AppliedModifier{ModifierID: 7, Quantity: 1}
+	existing := []models.OrderItem{line(10, 3, 1), line(11, 3, 2, oat), line(12, 4, 1)}
+	requested := []models.OrderItem{
+		line(99, 3, 5, oat), // matches 11; a client-sent ID is ignored
+		line(0, 3, 1),       // matches 10
+		line(0, 3, 1),       // 10 is taken, so this is a new line
+		line(0, 5, 1),       // new product
+	}
+	requested[0].UnitPrice = 0
+
+	got := matchLines(existing, requested)
+	want := []struct {
+		id       int64
+		quantity int
+		price    float64
+	}{{11, 5, 3}, {10, 1, 3}, {0, 1, 3}, {0, 1, 5}}
+	if len(got) != len(want) {
+		t.Fatalf("matchLines() returned %d lines, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].ID != w.id || got[i].Quantity != w.quantity || got[i].UnitPrice != w.price {
+			t.Errorf("line %d = id %d, quantity %d, price %v; want id %d, quantity %d, price %v",
+				i, got[i].ID, got[i].Quantity, got[i].UnitPrice, w.id, w.quantity, w.price)
+		}
+	}
+}
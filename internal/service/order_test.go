@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"frappuccino/internal/apperr"
+	"frappuccino/internal/repository"
+	"frappuccino/models"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// openTestDB connects to the database named by TEST_DATABASE_URL, which must
+// have db/init.sql applied. Tests that need it are skipped when it is unset.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatalf("ping database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestCreateOrderDoesNotOversell(t *testing.T) {
+	const (
+		stocked = 5
+		orders  = 20
+	)
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	orderRepo := repository.NewOrderRepository(db)
+	menuRepo := repository.NewMenuRepository(db)
+	inventoryRepo := repository.NewInventoryRepository(db)
+	svc := NewOrderService(orderRepo, menuRepo, inventoryRepo,
+		repository.NewModifierRepository(db), repository.NewIdempotencyRepository(db), db)
+
+	suffix := time.Now().UnixNano()
+	ingredient, err := inventoryRepo.Create(ctx, models.NewInventoryItem(
+		fmt.Sprintf("oversell ingredient %d", suffix), decimal.NewFromInt(stocked), "unit"))
+	if err != nil {
+		t.Fatalf("create inventory item: %v", err)
+	}
+	menuItem, err := menuRepo.Create(ctx, models.MenuItem{
+		Name:       fmt.Sprintf("oversell item %d", suffix),
+		Categories: []string{"test"},
+		Price:      1,
+		Ingredients: []models.MenuItemIngredient{
+			{IngredientID: ingredient.IngredientID, Quantity: decimal.NewFromInt(1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create menu item: %v", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		created  []int64
+		failures []error
+		wg       sync.WaitGroup
+	)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM orders WHERE order_id = ANY($1)`, pq.Array(created))
+		db.Exec(`DELETE FROM inventory_transactions WHERE inventory_id = $1`, ingredient.IngredientID)
+		db.Exec(`DELETE FROM menu_items WHERE product_id = $1`, menuItem.ID)
+		db.Exec(`DELETE FROM inventory WHERE ingredient_id = $1`, ingredient.IngredientID)
+	})
+
+	start := make(chan struct{})
+	for i := 0; i < orders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			order, err := svc.CreateOrder(ctx, models.Order{
+				CustomerName: fmt.Sprintf("customer %d", i),
+				Items:        []models.OrderItem{{ProductID: menuItem.ID, Quantity: 1}},
+			}, nil)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures = append(failures, err)
+				return
+			}
+			created = append(created, order.ID)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if len(created) != stocked {
+		t.Errorf("%d orders succeeded, want %d", len(created), stocked)
+	}
+	for _, err := range failures {
+		var appErr *apperr.Error
+		if !errors.As(err, &appErr) || appErr.Code != apperr.CodeInsufficientStock {
+			t.Errorf("order failed with %v, want %s", err, apperr.CodeInsufficientStock)
+		}
+	}
+
+	item, err := inventoryRepo.GetByID(ctx, ingredient.IngredientID)
+	if err != nil {
+		t.Fatalf("reload inventory item: %v", err)
+	}
+	if !item.Quantity.IsZero() {
+		t.Errorf("quantity left is %s, want 0", item.Quantity)
+	}
+
+	var count int
+	var consumed decimal.Decimal
+	err = db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(quantity_change), 0)
+		FROM inventory_transactions
+		WHERE inventory_id = $1 AND transaction_type = 'order_consumption'`, ingredient.IngredientID).
+		Scan(&count, &consumed)
+	if err != nil {
+		t.Fatalf("read ledger: %v", err)
+	}
+	if count != len(created) {
+		t.Errorf("%d order_consumption rows, want %d", count, len(created))
+	}
+	if !consumed.Equal(decimal.NewFromInt(-stocked)) {
+		t.Errorf("ledger consumed %s, want %d", consumed, -stocked)
+	}
+}
+
+// ingredientFixture creates menu items and inventory for a test and removes
+// them, and the orders made from them, when the test ends.
+type ingredientFixture struct {
+	t           *testing.T
+	db          *sql.DB
+	suffix      int64
+	orders      []int64
+	menuItems   []int64
+	ingredients []int64
+}
+
+func newIngredientFixture(t *testing.T, db *sql.DB) *ingredientFixture {
+	f := &ingredientFixture{t: t, db: db, suffix: time.Now().UnixNano()}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM orders WHERE order_id = ANY($1)`, pq.Array(f.orders))
+		db.Exec(`DELETE FROM inventory_transactions WHERE inventory_id = ANY($1)`, pq.Array(f.ingredients))
+		db.Exec(`DELETE FROM menu_items WHERE product_id = ANY($1)`, pq.Array(f.menuItems))
+		db.Exec(`DELETE FROM inventory WHERE ingredient_id = ANY($1)`, pq.Array(f.ingredients))
+	})
+	return f
+}
+
+func (f *ingredientFixture) inventoryItem(name string, quantity int64, unit string) int64 {
+	f.t.Helper()
+	item, err := repository.NewInventoryRepository(f.db).Create(context.Background(), models.NewInventoryItem(
+		fmt.Sprintf("%s %d", name, f.suffix), decimal.NewFromInt(quantity), unit))
+	if err != nil {
+		f.t.Fatalf("create inventory item: %v", err)
+	}
+	f.ingredients = append(f.ingredients, item.IngredientID)
+	return item.IngredientID
+}
+
+func (f *ingredientFixture) menuItem(name string, ingredients ...models.MenuItemIngredient) int64 {
+	f.t.Helper()
+	item, err := repository.NewMenuRepository(f.db).Create(context.Background(), models.MenuItem{
+		Name:        fmt.Sprintf("%s %d", name, f.suffix),
+		Categories:  []string{"test"},
+		Price:       1,
+		Ingredients: ingredients,
+	})
+	if err != nil {
+		f.t.Fatalf("create menu item: %v", err)
+	}
+	f.menuItems = append(f.menuItems, item.ID)
+	return item.ID
+}
+
+func (f *ingredientFixture) order(svc OrderService, items ...models.OrderItem) models.Order {
+	f.t.Helper()
+	order, err := svc.CreateOrder(context.Background(), models.Order{CustomerName: "customer", Items: items}, nil)
+	if err != nil {
+		f.t.Fatalf("create order: %v", err)
+	}
+	f.orders = append(f.orders, order.ID)
+	return order
+}
+
+func (f *ingredientFixture) expectStock(id int64, want string) {
+	f.t.Helper()
+	item, err := repository.NewInventoryRepository(f.db).GetByID(context.Background(), id)
+	if err != nil {
+		f.t.Fatalf("reload inventory item: %v", err)
+	}
+	if !item.Quantity.Equal(decimal.RequireFromString(want)) {
+		f.t.Errorf("%s: quantity is %s, want %s", item.Name, item.Quantity, want)
+	}
+}
+
+func lineOf(order models.Order, productID int64) int64 {
+	for _, item := range order.Items {
+		if item.ProductID == productID {
+			return item.ID
+		}
+	}
+	return 0
+}
+
+func TestEditOrderAfterIngredientForceDeleted(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	inventoryRepo := repository.NewInventoryRepository(db)
+	svc := NewOrderService(repository.NewOrderRepository(db), repository.NewMenuRepository(db), inventoryRepo,
+		repository.NewModifierRepository(db), repository.NewIdempotencyRepository(db), db)
+	f := newIngredientFixture(t, db)
+
+	kept := f.inventoryItem("kept ingredient", 10, "unit")
+	deleted := f.inventoryItem("deleted ingredient", 10, "unit")
+	both := f.menuItem("item with both",
+		models.MenuItemIngredient{IngredientID: kept, Quantity: decimal.NewFromInt(1)},
+		models.MenuItemIngredient{IngredientID: deleted, Quantity: decimal.NewFromInt(1)})
+	only := f.menuItem("item with deleted", models.MenuItemIngredient{IngredientID: deleted, Quantity: decimal.NewFromInt(1)})
+	order := f.order(svc,
+		models.OrderItem{ProductID: both, Quantity: 3},
+		models.OrderItem{ProductID: only, Quantity: 1})
+
+	err := NewInventoryService(inventoryRepo, db).DeleteInventoryItem(ctx, deleted, 0, models.InventoryDeletion{Force: true})
+	if err != nil {
+		t.Fatalf("force delete: %v", err)
+	}
+
+	if order, err = svc.UpdateOrderItem(ctx, order.ID, lineOf(order, both), 1, 0); err != nil {
+		t.Fatalf("shrink line: %v", err)
+	}
+	f.expectStock(kept, "9")
+	if _, err = svc.RemoveOrderItem(ctx, order.ID, lineOf(order, only), 0); err != nil {
+		t.Fatalf("remove line: %v", err)
+	}
+	if _, err := svc.CancelOrder(ctx, order.ID); err != nil {
+		t.Fatalf("cancel order: %v", err)
+	}
+	f.expectStock(kept, "10")
+}
+
+func TestEditOrderAfterIngredientReplaced(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	inventoryRepo := repository.NewInventoryRepository(db)
+	svc := NewOrderService(repository.NewOrderRepository(db), repository.NewMenuRepository(db), inventoryRepo,
+		repository.NewModifierRepository(db), repository.NewIdempotencyRepository(db), db)
+	f := newIngredientFixture(t, db)
+
+	replaced := f.inventoryItem("replaced ingredient", 5000, "g")
+	replacement := f.inventoryItem("replacement ingredient", 5, "kg")
+	menuItem := f.menuItem("item", models.MenuItemIngredient{IngredientID: replaced, Quantity: decimal.NewFromInt(500)})
+	order := f.order(svc, models.OrderItem{ProductID: menuItem, Quantity: 2})
+	line := lineOf(order, menuItem)
+
+	err := NewInventoryService(inventoryRepo, db).DeleteInventoryItem(ctx, replaced, 0, models.InventoryDeletion{ReplacementID: replacement})
+	if err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+
+	if _, err := svc.UpdateOrderItem(ctx, order.ID, line, 3, 0); err != nil {
+		t.Fatalf("grow line: %v", err)
+	}
+	f.expectStock(replacement, "4.5")
+	// Only what was taken from the replacement goes back to it.
+	if _, err := svc.UpdateOrderItem(ctx, order.ID, line, 1, 0); err != nil {
+		t.Fatalf("shrink line: %v", err)
+	}
+	f.expectStock(replacement, "5")
+	if _, err := svc.CancelOrder(ctx, order.ID); err != nil {
+		t.Fatalf("cancel order: %v", err)
+	}
+	f.expectStock(replacement, "5")
+}
@@ -1,10 +1,13 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"frappuccino/internal/apperr"
 	"frappuccino/internal/repository"
 	"frappuccino/models"
 	"log"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,10 +15,11 @@ import (
 )
 
 type ReportsService interface {
-	SearchReport(q, filter, min, max string) (models.SearchReportResponse, error)
-	GetOrderedItemsByPeriod(period, month, year string) (models.OrderedItemsByPeriodResponse, error)
-	GetTotalSales() (float64, error)
-	GetPopularItems(limit int) ([]models.MenuItem, error)
+	SearchReport(ctx context.Context, q, filter, min, max string) (models.SearchReportResponse, error)
+	GetOrderedItemsByPeriod(ctx context.Context, period, month, year string) (models.OrderedItemsByPeriodResponse, error)
+	GetTotalSales(ctx context.Context) (float64, error)
+	GetPopularItems(ctx context.Context, limit int) ([]models.MenuItem, error)
+	GetMargins(ctx context.Context) ([]models.MenuItemMargin, error)
 }
 
 type reportsService struct {
@@ -36,43 +40,47 @@ func NewReportsService(
 	}
 }
 
-func (s *reportsService) GetTotalSales() (float64, error) {
-	orders, err := s.orderRepo.GetAll()
-	if err != nil {
-		return 0, err
-	}
+func (s *reportsService) GetTotalSales(ctx context.Context) (float64, error) {
+	return s.repo.GetTotalSales(ctx)
+}
 
-	menuItems, err := s.menuRepo.GetAll()
+func (s *reportsService) GetMargins(ctx context.Context) ([]models.MenuItemMargin, error) {
+	items, err := s.menuRepo.GetAll(ctx)
 	if err != nil {
-		return 0, err
-	}
-
-	menuItemMap := make(map[int64]models.MenuItem, len(menuItems))
-	for _, item := range menuItems {
-		menuItemMap[item.ID] = item
+		return nil, err
 	}
 
-	var totalSales float64
-	for _, order := range orders {
-		if order.Status == "closed" {
-			for _, item := range order.Items {
-				if menuItem, exists := menuItemMap[item.ProductID]; exists {
-					totalSales += menuItem.Price * float64(item.Quantity)
-				}
-			}
+	margins := make([]models.MenuItemMargin, 0, len(items))
+	for _, item := range items {
+		if item.ArchivedAt != nil {
+			continue
+		}
+		cost := item.Cost()
+		margin := models.MenuItemMargin{
+			ProductID:   item.ID,
+			Name:        item.Name,
+			Price:       item.Price,
+			Cost:        cost,
+			GrossMargin: roundPrice(item.Price - cost),
 		}
+		if item.Price > 0 {
+			margin.MarginPercent = math.Round(margin.GrossMargin/item.Price*1000) / 10
+		}
+		margins = append(margins, margin)
 	}
-
-	return totalSales, nil
+	sort.SliceStable(margins, func(i, j int) bool {
+		return margins[i].MarginPercent < margins[j].MarginPercent
+	})
+	return margins, nil
 }
 
-func (s *reportsService) GetPopularItems(limit int) ([]models.MenuItem, error) {
-	orders, err := s.orderRepo.GetAll()
+func (s *reportsService) GetPopularItems(ctx context.Context, limit int) ([]models.MenuItem, error) {
+	orders, err := s.orderRepo.GetAll(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	menuItems, err := s.menuRepo.GetAll()
+	menuItems, err := s.menuRepo.GetAll(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -115,7 +123,7 @@ func (s *reportsService) GetPopularItems(limit int) ([]models.MenuItem, error) {
 	return result, nil
 }
 
-func (s *reportsService) SearchReport(q, filter, min, max string) (models.SearchReportResponse, error) {
+func (s *reportsService) SearchReport(ctx context.Context, q, filter, min, max string) (models.SearchReportResponse, error) {
 	minPrice := 0.0
 	maxPrice := 999999.0
 	if s.repo == nil {
@@ -137,21 +145,21 @@ func (s *reportsService) SearchReport(q, filter, min, max string) (models.Search
 		filters = strings.Split(filter, ",")
 	}
 
-	return s.repo.SearchReports(q, filters, minPrice, maxPrice)
+	return s.repo.SearchReports(ctx, q, filters, minPrice, maxPrice)
 }
 
-func (s *reportsService) GetOrderedItemsByPeriod(period, month, year string) (models.OrderedItemsByPeriodResponse, error) {
+func (s *reportsService) GetOrderedItemsByPeriod(ctx context.Context, period, month, year string) (models.OrderedItemsByPeriodResponse, error) {
 	resp := models.OrderedItemsByPeriodResponse{
 		Period: period,
 	}
 
 	if period == "day" {
 		if month == "" {
-			return resp, fmt.Errorf("month parameter required for period=day")
+			return resp, apperr.Validation("month parameter required for period=day")
 		}
 		monthParsed, err := time.Parse("January", strings.Title(month))
 		if err != nil {
-			return resp, fmt.Errorf("invalid month: %s", month)
+			return resp, apperr.Validation("invalid month: %s", month)
 		}
 
 		yearInt := time.Now().Year()
@@ -163,7 +171,7 @@ func (s *reportsService) GetOrderedItemsByPeriod(period, month, year string) (mo
 
 		resp.Month = strings.ToLower(month)
 
-		data, err := s.repo.GetOrderedItemsByDay(yearInt, monthParsed.Month())
+		data, err := s.repo.GetOrderedItemsByDay(ctx, yearInt, monthParsed.Month())
 		if err != nil {
 			return resp, err
 		}
@@ -191,7 +199,7 @@ func (s *reportsService) GetOrderedItemsByPeriod(period, month, year string) (mo
 
 		resp.Year = year
 
-		data, err := s.repo.GetOrderedItemsByMonth(yearInt)
+		data, err := s.repo.GetOrderedItemsByMonth(ctx, yearInt)
 		if err != nil {
 			return resp, err
 		}
@@ -213,5 +221,5 @@ func (s *reportsService) GetOrderedItemsByPeriod(period, month, year string) (mo
 		return resp, nil
 	}
 
-	return resp, fmt.Errorf("invalid period parameter: %s", period)
+	return resp, apperr.Validation("invalid period parameter: %s", period)
 }
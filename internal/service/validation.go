@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"frappuccino/internal/repository"
+	"frappuccino/internal/validation"
+	"frappuccino/models"
+	"slices"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+const maxNameLength = 255
+
+func validateOrder(ctx context.Context, menuRepo repository.MenuRepository, order models.Order) error {
+	var v validation.Errors
+	validateCustomerName(&v, order.CustomerName)
+	v.Check(len(order.Items) > 0, "items", "must contain at least one item")
+
+	productIDs := make([]int64, 0, len(order.Items))
+	for i, item := range order.Items {
+		validateOrderItem(&v, fmt.Sprintf("items[%d].", i), item)
+		if item.ProductID > 0 {
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+
+	existing, err := menuRepo.ExistingIDs(ctx, productIDs)
+	if err != nil {
+		return err
+	}
+	for i, item := range order.Items {
+		if item.ProductID > 0 && !existing[item.ProductID] {
+			v.Add(fmt.Sprintf("items[%d].product_id", i), "product '%d' does not exist", item.ProductID)
+		}
+	}
+	return v.Err()
+}
+
+func validateOrderItem(v *validation.Errors, prefix string, item models.OrderItem) {
+	v.Check(item.ProductID > 0, prefix+"product_id", "is required")
+	v.Check(item.Quantity > 0, prefix+"quantity", "must be positive")
+	for j, m := range item.Customization.Modifiers {
+		modifierField := fmt.Sprintf("%scustomization.modifiers[%d]", prefix, j)
+		v.Check(m.ModifierID > 0, modifierField+".modifier_id", "is required")
+		v.Check(m.Quantity >= 0, modifierField+".quantity", "cannot be negative")
+	}
+}
+
+func validateCustomerName(v *validation.Errors, name string) {
+	v.Required("customer_name", name)
+	v.MaxLength("customer_name", name, maxNameLength)
+}
+
+func validateMenuItem(ctx context.Context, inventoryRepo repository.InventoryRepository, item *models.MenuItem) error {
+	var v validation.Errors
+	v.Required("name", item.Name)
+	v.MaxLength("name", item.Name, maxNameLength)
+	v.Check(item.Price > 0, "price", "must be positive")
+	for i, category := range item.Categories {
+		v.Required(fmt.Sprintf("categories[%d]", i), category)
+	}
+
+	ids := make([]int64, 0, len(item.Ingredients))
+	seen := make(map[int64]bool, len(item.Ingredients))
+	for i, ing := range item.Ingredients {
+		field := fmt.Sprintf("ingredients[%d]", i)
+		v.Check(ing.IngredientID > 0, field+".ingredient_id", "is required")
+		checkQuantity(&v, field+".quantity", ing.Quantity, true)
+		if ing.Unit != "" {
+			v.OneOf(field+".unit", ing.Unit, models.Units)
+		}
+		if ing.IngredientID > 0 {
+			v.Check(!seen[ing.IngredientID], field+".ingredient_id", "ingredient '%d' is listed more than once", ing.IngredientID)
+			seen[ing.IngredientID] = true
+			ids = append(ids, ing.IngredientID)
+		}
+	}
+
+	stockUnits, err := inventoryRepo.GetUnits(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range item.Ingredients {
+		ing := &item.Ingredients[i]
+		field := fmt.Sprintf("ingredients[%d]", i)
+		if ing.IngredientID <= 0 {
+			continue
+		}
+		stockUnit, ok := stockUnits[ing.IngredientID]
+		if !ok {
+			v.Add(field+".ingredient_id", "ingredient '%d' does not exist", ing.IngredientID)
+			continue
+		}
+		if ing.Unit == "" {
+			ing.Unit = stockUnit
+		} else if slices.Contains(models.Units, ing.Unit) && !models.UnitsCompatible(ing.Unit, stockUnit) {
+			v.Add(field+".unit", "%s cannot be converted to %s, the unit ingredient '%d' is stocked in",
+				ing.Unit, stockUnit, ing.IngredientID)
+		}
+	}
+	return v.Err()
+}
+
+func validateInventoryItem(item models.InventoryItem) error {
+	return validateInventoryUpdate(models.InventoryUpdate{
+		Name:         item.Name,
+		Quantity:     &item.Quantity,
+		Unit:         item.Unit,
+		ReorderLevel: &item.ReorderLevel,
+		CostPerUnit:  &item.CostPerUnit,
+	})
+}
+
+func validateInventoryUpdate(u models.InventoryUpdate) error {
+	var v validation.Errors
+	v.Required("name", u.Name)
+	v.MaxLength("name", u.Name, maxNameLength)
+	if u.Quantity != nil {
+		checkQuantity(&v, "quantity", *u.Quantity, false)
+	}
+	if u.ReorderLevel != nil {
+		checkQuantity(&v, "reorder_level", *u.ReorderLevel, false)
+	}
+	v.Check(u.CostPerUnit == nil || *u.CostPerUnit >= 0, "cost_per_unit", "cannot be negative")
+	v.OneOf("unit", u.Unit, models.Units)
+	return v.Err()
+}
+
+// validateModifier clears the fields that do not belong to the modifier's kind.
+func validateModifier(ctx context.Context, menuRepo repository.MenuRepository, inventoryRepo repository.InventoryRepository, m *models.Modifier) error {
+	var v validation.Errors
+	v.Required("name", m.Name)
+	v.MaxLength("name", m.Name, maxNameLength)
+	if m.Kind == "" {
+		m.Kind = models.ModifierAdd
+	}
+
+	fieldsOf := make(map[int64][]string)
+	switch m.Kind {
+	case models.ModifierAdd:
+		v.Check(len(m.Ingredients) > 0, "ingredients", "an add modifier needs at least one ingredient")
+		for i, ing := range m.Ingredients {
+			field := fmt.Sprintf("ingredients[%d]", i)
+			v.Check(ing.IngredientID > 0, field+".ingredient_id", "is required")
+			checkQuantity(&v, field+".quantity", ing.Quantity, true)
+			if ing.IngredientID > 0 {
+				fieldsOf[ing.IngredientID] = append(fieldsOf[ing.IngredientID], field+".ingredient_id")
+			}
+		}
+		m.ReplacesIngredientID = 0
+		m.SubstituteIngredientID = 0
+	case models.ModifierSubstitute:
+		v.Check(m.ReplacesIngredientID > 0, "replaces_ingredient_id", "is required for a substitute modifier")
+		v.Check(m.SubstituteIngredientID > 0, "substitute_ingredient_id", "is required for a substitute modifier")
+		v.Check(m.ReplacesIngredientID == 0 || m.ReplacesIngredientID != m.SubstituteIngredientID,
+			"substitute_ingredient_id", "an ingredient cannot substitute itself")
+		if m.ReplacesIngredientID > 0 {
+			fieldsOf[m.ReplacesIngredientID] = append(fieldsOf[m.ReplacesIngredientID], "replaces_ingredient_id")
+		}
+		if m.SubstituteIngredientID > 0 {
+			fieldsOf[m.SubstituteIngredientID] = append(fieldsOf[m.SubstituteIngredientID], "substitute_ingredient_id")
+		}
+		m.Ingredients = nil
+	default:
+		v.OneOf("kind", string(m.Kind), []string{string(models.ModifierAdd), string(models.ModifierSubstitute)})
+	}
+
+	if err := checkIngredientsExist(ctx, inventoryRepo, &v, fieldsOf); err != nil {
+		return err
+	}
+	if m.Kind == models.ModifierSubstitute && m.ReplacesIngredientID > 0 && m.SubstituteIngredientID > 0 {
+		units, err := inventoryRepo.GetUnits(ctx, []int64{m.ReplacesIngredientID, m.SubstituteIngredientID})
+		if err != nil {
+			return err
+		}
+		replaced, replacedOK := units[m.ReplacesIngredientID]
+		substitute, substituteOK := units[m.SubstituteIngredientID]
+		if replacedOK && substituteOK && !models.UnitsCompatible(replaced, substitute) {
+			v.Add("substitute_ingredient_id", "ingredient '%d' is stocked in %s, which cannot stand in for %s of ingredient '%d'",
+				m.SubstituteIngredientID, substitute, replaced, m.ReplacesIngredientID)
+		}
+	}
+
+	for i, category := range m.Categories {
+		v.Required(fmt.Sprintf("categories[%d]", i), category)
+	}
+	existing, err := menuRepo.ExistingIDs(ctx, m.ProductIDs)
+	if err != nil {
+		return err
+	}
+	for i, productID := range m.ProductIDs {
+		v.Check(existing[productID], fmt.Sprintf("product_ids[%d]", i), "product '%d' does not exist", productID)
+	}
+	return v.Err()
+}
+
+func checkQuantity(v *validation.Errors, field string, q decimal.Decimal, positive bool) {
+	if positive {
+		v.Check(q.IsPositive(), field, "must be positive")
+	} else {
+		v.Check(!q.IsNegative(), field, "cannot be negative")
+	}
+	v.Check(hasQuantityPlaces(q), field, "can have at most %d decimal places", models.QuantityPlaces)
+}
+
+func hasQuantityPlaces(q decimal.Decimal) bool {
+	return q.Equal(q.Truncate(models.QuantityPlaces))
+}
+
+// checkIngredientsExist maps ingredient IDs to the fields they were given in.
+func checkIngredientsExist(ctx context.Context, inventoryRepo repository.InventoryRepository, v *validation.Errors, fieldsOf map[int64][]string) error {
+	ids := make([]int64, 0, len(fieldsOf))
+	for id := range fieldsOf {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	existing, err := inventoryRepo.ExistingIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if existing[id] {
+			continue
+		}
+		for _, field := range fieldsOf[id] {
+			v.Add(field, "ingredient '%d' does not exist", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"frappuccino/internal/apperr"
+	"frappuccino/internal/repository"
+	"frappuccino/models"
+	"testing"
+)
+
+type stubInventoryRepository struct {
+	repository.InventoryRepository
+	units map[int64]string
+}
+
+func (r stubInventoryRepository) ExistingIDs(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	existing := make(map[int64]bool)
+	for _, id := range ids {
+		_, existing[id] = r.units[id]
+	}
+	return existing, nil
+}
+
+func (r stubInventoryRepository) GetUnits(ctx context.Context, ids []int64) (map[int64]string, error) {
+	units := make(map[int64]string)
+	for _, id := range ids {
+		if unit, ok := r.units[id]; ok {
+			units[id] = unit
+		}
+	}
+	return units, nil
+}
+
+type stubMenuRepository struct {
+	repository.MenuRepository
+}
+
+func (stubMenuRepository) ExistingIDs(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	return map[int64]bool{}, nil
+}
+
+func TestValidateSubstituteModifierUnits(t *testing.T) {
+	inventory := stubInventoryRepository{units: map[int64]string{
+		1: models.UnitMilliliter, // milk
+		2: models.UnitLiter,      // oat milk
+		3: models.UnitGram,       // oat powder
+	}}
+	tests := []struct {
+		name       string
+		substitute int64
+		wantErr    bool
+	}{
+		{"same kind", 2, false},
+		{"different kind", 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := models.Modifier{
+				Name:                   "Swap",
+				Kind:                   models.ModifierSubstitute,
+				ReplacesIngredientID:   1,
+				SubstituteIngredientID: tt.substitute,
+			}
+			err := validateModifier(context.Background(), stubMenuRepository{}, inventory, &m)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("validateModifier() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, apperr.ErrValidation) {
+				t.Errorf("validateModifier() error = %v, want a validation error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"fmt"
+	"frappuccino/internal/apperr"
+	"strings"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Errors struct {
+	fields []FieldError
+}
+
+func (e *Errors) Add(field, format string, args ...any) {
+	e.fields = append(e.fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *Errors) Check(ok bool, field, format string, args ...any) {
+	if !ok {
+		e.Add(field, format, args...)
+	}
+}
+
+func (e *Errors) Required(field, value string) {
+	e.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+func (e *Errors) MaxLength(field, value string, n int) {
+	e.Check(len([]rune(value)) <= n, field, "must be at most %d characters", n)
+}
+
+func (e *Errors) OneOf(field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	e.Add(field, "must be one of %s", strings.Join(allowed, ", "))
+}
+
+func (e *Errors) Empty() bool {
+	return len(e.fields) == 0
+}
+
+func (e *Errors) Err() error {
+	if e.Empty() {
+		return nil
+	}
+	parts := make([]string, 0, len(e.fields))
+	for _, f := range e.fields {
+		parts = append(parts, f.Field+" "+f.Message)
+	}
+	return apperr.Validation("invalid request: %s", strings.Join(parts, "; ")).WithDetails(e.fields)
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	// StatusCode is 0 when no request with the key has succeeded yet.
+	StatusCode int
+	Body       []byte
+	CreatedAt  time.Time
+}
@@ -1,17 +1,27 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// QuantityPlaces is the number of decimal places stock quantities are stored with.
+const QuantityPlaces = 3
 
 type InventoryItem struct {
 	IngredientID int64
 	Name         string
-	Quantity     int
+	Quantity     decimal.Decimal
 	Unit         string
+	ReorderLevel decimal.Decimal
+	CostPerUnit  float64
+	Version      int64
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
-func NewInventoryItem(name string, quantity int, unit string) InventoryItem {
+func NewInventoryItem(name string, quantity decimal.Decimal, unit string) InventoryItem {
 	return InventoryItem{
 		IngredientID: 0, // заполняется после вставки в БД
 		Name:         name,
@@ -19,3 +29,81 @@ func NewInventoryItem(name string, quantity int, unit string) InventoryItem {
 		Unit:         unit,
 	}
 }
+
+// InventoryUpdate keeps the stored Quantity, ReorderLevel and CostPerUnit when they are nil.
+type InventoryUpdate struct {
+	IngredientID int64
+	Name         string
+	Quantity     *decimal.Decimal
+	Unit         string
+	ReorderLevel *decimal.Decimal
+	CostPerUnit  *float64
+	Version      int64
+}
+
+type TransactionType string
+
+const (
+	TransactionInitialStock     TransactionType = "initial_stock"
+	TransactionPurchase         TransactionType = "purchase"
+	TransactionWaste            TransactionType = "waste"
+	TransactionAdjustment       TransactionType = "adjustment"
+	TransactionOrderConsumption TransactionType = "order_consumption"
+	TransactionOrderReturn      TransactionType = "order_return"
+)
+
+type InventoryTransaction struct {
+	ID             int64
+	IngredientID   int64
+	QuantityChange decimal.Decimal
+	// Unit is what the item was stocked in when the movement was recorded.
+	Unit    string
+	Type    TransactionType
+	Reason  string
+	OrderID int64
+	// UnitCost is nil for movements other than purchases.
+	UnitCost  *float64
+	CreatedAt time.Time
+}
+
+type StockLevel struct {
+	IngredientID     int64
+	Name             string
+	Quantity         decimal.Decimal
+	Unit             string
+	CostPerUnit      float64
+	Value            float64
+	DailyConsumption float64
+	// DaysOfCover is nil when nothing was consumed.
+	DaysOfCover *float64
+}
+
+var StockLevelSortKeys = []string{"quantity", "value", "days_of_cover"}
+
+type IngredientShortage struct {
+	IngredientID int64
+	Name         string
+	Unit         string
+	Required     decimal.Decimal
+	Available    decimal.Decimal
+}
+
+type IngredientDependent struct {
+	ID   int64
+	Name string
+}
+
+type IngredientDependents struct {
+	MenuItems []IngredientDependent
+	Modifiers []IngredientDependent
+}
+
+func (d IngredientDependents) Empty() bool {
+	return len(d.MenuItems) == 0 && len(d.Modifiers) == 0
+}
+
+// InventoryDeletion with neither field set refuses to delete an item that is in use.
+type InventoryDeletion struct {
+	ReplacementID int64
+	Force         bool
+}
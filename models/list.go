@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type Cursor struct {
+	Sort  string
+	Desc  bool
+	Value string
+	ID    int64
+}
+
+type PageRequest struct {
+	Sort  string
+	Desc  bool
+	Limit int
+	After *Cursor
+}
+
+var (
+	OrderSortKeys     = []string{"id", "created_at", "total_price", "customer_name"}
+	MenuSortKeys      = []string{"id", "name", "price"}
+	InventorySortKeys = []string{"id", "name", "quantity"}
+)
+
+type OrderFilter struct {
+	Status   OrderStatus
+	Customer string
+	// A zero From or To leaves that side open.
+	From time.Time
+	To   time.Time
+}
+
+type MenuFilter struct {
+	Category        string
+	MinPrice        *float64
+	MaxPrice        *float64
+	IncludeArchived bool
+}
+
+type InventoryFilter struct {
+	Unit     string
+	LowStock bool
+}
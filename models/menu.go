@@ -1,7 +1,10 @@
 package models
 
 import (
+	"math"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type MenuItem struct {
@@ -11,14 +14,56 @@ type MenuItem struct {
 	Categories  []string
 	Price       float64
 	Ingredients []MenuItemIngredient
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	Modifiers   []Modifier
+	// AvailablePortions is nil when the item has no recipe and 0 once it is archived.
+	AvailablePortions *int
+	ArchivedAt        *time.Time
+	Version           int64
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
 }
 
 type MenuItemIngredient struct {
 	IngredientID int64
 	ProductName  string
-	Quantity     int
+	Quantity     decimal.Decimal
+	Unit         string
+	StockUnit    string
+	CostPerUnit  float64
+}
+
+func (ing MenuItemIngredient) StockQuantity() (decimal.Decimal, error) {
+	return ConvertQuantity(ing.Quantity, ing.Unit, ing.StockUnit)
+}
+
+func (m MenuItem) Cost() float64 {
+	var cost float64
+	for _, ing := range m.Ingredients {
+		if quantity, err := ing.StockQuantity(); err == nil {
+			cost += quantity.InexactFloat64() * ing.CostPerUnit
+		}
+	}
+	return math.Round(cost*100) / 100
+}
+
+type MenuItemAvailability struct {
+	ProductID            int64
+	ProductName          string
+	AvailablePortions    *int
+	LimitingIngredientID int64
+	LimitingIngredient   string
+}
+
+func (a MenuItemAvailability) Available() bool {
+	return a.AvailablePortions == nil || *a.AvailablePortions > 0
+}
+
+type PriceChange struct {
+	ID        int64
+	ProductID int64
+	OldPrice  float64
+	NewPrice  float64
+	ChangedAt time.Time
 }
 
 func NewMenuItem(name, description string, categories []string, price float64, ingredients []MenuItemIngredient) MenuItem {
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type ModifierKind string
+
+const (
+	ModifierAdd        ModifierKind = "add"
+	ModifierSubstitute ModifierKind = "substitute"
+)
+
+type Modifier struct {
+	ID                     int64
+	Name                   string
+	Kind                   ModifierKind
+	PriceDelta             float64
+	ReplacesIngredientID   int64
+	SubstituteIngredientID int64
+	Ingredients            []ModifierIngredient
+	// A modifier with neither Categories nor ProductIDs applies to every item.
+	Categories []string
+	ProductIDs []int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type ModifierIngredient struct {
+	IngredientID int64
+	ProductName  string
+	Quantity     decimal.Decimal
+	Unit         string
+}
+
+func (m Modifier) AppliesTo(item MenuItem) bool {
+	if len(m.Categories) == 0 && len(m.ProductIDs) == 0 {
+		return true
+	}
+	for _, id := range m.ProductIDs {
+		if id == item.ID {
+			return true
+		}
+	}
+	for _, category := range m.Categories {
+		for _, itemCategory := range item.Categories {
+			if category == itemCategory {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type OrderStatus string
@@ -13,18 +15,57 @@ const (
 	StatusCancelled  OrderStatus = "cancelled"
 )
 
+var OrderStatuses = []string{
+	string(StatusPending), string(StatusProcessing), string(StatusClosed), string(StatusCancelled),
+}
+
 type Order struct {
 	ID           int64
 	CustomerName string
 	Items        []OrderItem
 	TotalPrice   float64
 	Status       OrderStatus
+	Version      int64
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
 type OrderItem struct {
-	ProductID   int64
-	ProductName string
-	Quantity    int
+	ID            int64
+	ProductID     int64
+	ProductName   string
+	Quantity      int
+	UnitPrice     float64
+	Customization Customization
+	// Consumption is what one unit took from stock when the line was added.
+	Consumption []IngredientUse
+}
+
+type IngredientUse struct {
+	IngredientID int64           `json:"ingredient_id"`
+	Quantity     decimal.Decimal `json:"quantity"`
+	Unit         string          `json:"unit"`
+}
+
+type Customization struct {
+	Modifiers []AppliedModifier `json:"modifiers,omitempty"`
+}
+
+type AppliedModifier struct {
+	ModifierID int64   `json:"modifier_id"`
+	Name       string  `json:"name"`
+	Quantity   int     `json:"quantity"`
+	PriceDelta float64 `json:"price_delta"`
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	switch next {
+	case StatusProcessing:
+		return s == StatusPending
+	case StatusClosed:
+		return s == StatusProcessing
+	case StatusCancelled:
+		return s == StatusPending || s == StatusProcessing
+	}
+	return false
 }
@@ -1,35 +1,44 @@
 package models
 
 type MenuItemSearchResult struct {
-	ID          int     `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Relevance   float64 `json:"relevance"`
+	ID          int
+	Name        string
+	Description string
+	Price       float64
+	Relevance   float64
 }
 
 type OrderSearchResult struct {
-	ID           int      `json:"id"`
-	CustomerName string   `json:"customer_name"`
-	Items        []string `json:"items"`
-	Total        float64  `json:"total"`
-	Relevance    float64  `json:"relevance"`
+	ID           int
+	CustomerName string
+	Items        []string
+	Total        float64
+	Relevance    float64
 }
 
 type SearchReportResponse struct {
-	MenuItems    []MenuItemSearchResult `json:"menu_items"`
-	Orders       []OrderSearchResult    `json:"orders"`
-	TotalMatches int                    `json:"total_matches"`
+	MenuItems    []MenuItemSearchResult
+	Orders       []OrderSearchResult
+	TotalMatches int
+}
+
+type MenuItemMargin struct {
+	ProductID     int64
+	Name          string
+	Price         float64
+	Cost          float64
+	GrossMargin   float64
+	MarginPercent float64
 }
 
 type OrderedItemCount struct {
-	Key   string `json:"key"`
-	Count int    `json:"count"`
+	Key   string
+	Count int
 }
 
 type OrderedItemsByPeriodResponse struct {
-	Period       string             `json:"period"`
-	Month        string             `json:"month,omitempty"`
-	Year         string             `json:"year,omitempty"`
-	OrderedItems []OrderedItemCount `json:"orderedItems"`
+	Period       string
+	Month        string
+	Year         string
+	OrderedItems []OrderedItemCount
 }
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	UnitKilogram   = "kg"
+	UnitGram       = "g"
+	UnitLiter      = "liter"
+	UnitMilliliter = "ml"
+	UnitPiece      = "unit"
+)
+
+var Units = []string{UnitKilogram, UnitGram, UnitLiter, UnitMilliliter, UnitPiece}
+
+var unitScales = map[string]struct {
+	base   string
+	factor decimal.Decimal
+}{
+	UnitKilogram:   {UnitGram, decimal.NewFromInt(1000)},
+	UnitGram:       {UnitGram, decimal.NewFromInt(1)},
+	UnitLiter:      {UnitMilliliter, decimal.NewFromInt(1000)},
+	UnitMilliliter: {UnitMilliliter, decimal.NewFromInt(1)},
+	UnitPiece:      {UnitPiece, decimal.NewFromInt(1)},
+}
+
+type UnitMismatchError struct {
+	From string
+	To   string
+}
+
+func (e *UnitMismatchError) Error() string {
+	return fmt.Sprintf("cannot convert %s to %s", e.From, e.To)
+}
+
+func BaseUnit(unit string) string {
+	if scale, ok := unitScales[unit]; ok {
+		return scale.base
+	}
+	return unit
+}
+
+func UnitsCompatible(from, to string) bool {
+	f, ok := unitScales[from]
+	t, ok2 := unitScales[to]
+	return ok && ok2 && f.base == t.base
+}
+
+func ConvertQuantity(quantity decimal.Decimal, from, to string) (decimal.Decimal, error) {
+	if !UnitsCompatible(from, to) {
+		return decimal.Zero, &UnitMismatchError{From: from, To: to}
+	}
+	return quantity.Mul(unitScales[from].factor).Div(unitScales[to].factor), nil
+}